@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/algod"
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/algorand/go-algorand-sdk/crypto"
+	"github.com/algorand/go-algorand-sdk/types"
+)
+
+const (
+	// algodPageSize is the minimum number of transactions in a page, pages always end with a whole block.
+	algodPageSize = 1000
+	// algodBlockCacheSize is the number of walked blocks kept for the other accounts of the export.
+	algodBlockCacheSize = 10000
+)
+
+// algodClient is the part of an algod node used by algodSource.
+type algodClient interface {
+	LastRound() (uint64, error)
+	Block(round uint64) (types.Block, error)
+	AssetByID(assetID uint64) (models.Asset, error)
+}
+
+// algodNode is an algodClient for an algod REST API.
+type algodNode struct {
+	client *algod.Client
+}
+
+func (n *algodNode) LastRound() (uint64, error) {
+	status, err := n.client.Status().Do(context.TODO())
+	return status.LastRound, err
+}
+
+func (n *algodNode) Block(round uint64) (types.Block, error) {
+	return n.client.Block(round).Do(context.TODO())
+}
+
+func (n *algodNode) AssetByID(assetID uint64) (models.Asset, error) {
+	return n.client.GetAssetByID(assetID).Do(context.TODO())
+}
+
+// algodSource looks up account transactions by walking the blocks of an archival algod node,
+// newest first like the indexer. Pages always hold whole blocks and NextToken is the next round to walk.
+//
+// An algod node has no account index, so every block of the query is fetched. Blocks are converted once
+// for all the exported accounts and kept in a bounded cache, so concurrent accounts share the walk.
+type algodSource struct {
+	client   algodClient
+	limiter  *rateLimiter
+	accounts map[string]bool
+	pageSize int
+
+	mu     sync.Mutex
+	blocks map[uint64]algodBlock
+	rounds []uint64 // Cached rounds in insertion order, for eviction.
+}
+
+// algodBlock holds the transactions of a block touching the exported accounts.
+type algodBlock struct {
+	timestamp int64
+	txns      []algodTxn
+}
+
+// algodTxn is a block transaction touching at least one of the exported accounts.
+type algodTxn struct {
+	tx       models.Transaction
+	accounts map[string]bool
+}
+
+func newAlgodSource(client algodClient, limiter *rateLimiter, accounts []string) *algodSource {
+	s := &algodSource{
+		client:   client,
+		limiter:  limiter,
+		accounts: map[string]bool{},
+		pageSize: algodPageSize,
+		blocks:   map[uint64]algodBlock{},
+	}
+	for _, account := range accounts {
+		s.accounts[account] = true
+	}
+	return s
+}
+
+func (s *algodSource) LookupAccountTransactions(account string, query transactionQuery, nextToken string) (models.TransactionsResponse, error) {
+	var response models.TransactionsResponse
+	if !s.accounts[account] {
+		return response, fmt.Errorf("account %s was not configured for the algod source", account)
+	}
+	s.limiter.Wait()
+	lastRound, err := s.client.LastRound()
+	if err != nil {
+		return response, fmt.Errorf("error looking up algod status: %w", err)
+	}
+	response.CurrentRound = lastRound
+
+	round := lastRound
+	if query.MaxRound != 0 && query.MaxRound < round {
+		round = query.MaxRound
+	}
+	if nextToken != "" {
+		if round, err = strconv.ParseUint(nextToken, 10, 64); err != nil {
+			return response, fmt.Errorf("invalid algod next token %q: %w", nextToken, err)
+		}
+	} else if !query.BeforeTime.IsZero() {
+		if round, err = s.lastRoundBefore(query.MinRound, round, query.BeforeTime); err != nil {
+			return response, err
+		}
+	}
+
+	for ; round >= query.MinRound && round > 0; round-- {
+		block, err := s.block(round)
+		if err != nil {
+			return response, err
+		}
+		if !query.AfterTime.IsZero() && !time.Unix(block.timestamp, 0).After(query.AfterTime) {
+			round = 0 // Older blocks are all before the query.
+			break
+		}
+		// Transactions are returned newest first, including within a block.
+		for i := len(block.txns) - 1; i >= 0; i-- {
+			if block.txns[i].accounts[account] && query.matches(block.txns[i].tx) {
+				response.Transactions = append(response.Transactions, block.txns[i].tx)
+			}
+		}
+		if len(response.Transactions) >= s.pageSize {
+			round--
+			break
+		}
+	}
+	// An empty page ends the export, so only continue after a page with transactions.
+	if len(response.Transactions) > 0 && round >= query.MinRound && round > 0 {
+		response.NextToken = strconv.FormatUint(round, 10)
+	}
+	return response, nil
+}
+
+// lastRoundBefore finds the last round in [minRound, maxRound] with a block time before t.
+func (s *algodSource) lastRoundBefore(minRound uint64, maxRound uint64, t time.Time) (uint64, error) {
+	if minRound == 0 {
+		minRound = 1
+	}
+	low, high := minRound, maxRound
+	for low < high {
+		mid := low + (high-low+1)/2
+		timestamp, err := s.blockTime(mid)
+		if err != nil {
+			return 0, err
+		}
+		if time.Unix(timestamp, 0).Before(t) {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return low, nil
+}
+
+func (s *algodSource) blockTime(round uint64) (int64, error) {
+	s.limiter.Wait()
+	block, err := s.client.Block(round)
+	if err != nil {
+		return 0, fmt.Errorf("error looking up block %d: %w", round, err)
+	}
+	return block.TimeStamp, nil
+}
+
+// block returns the transactions of round touching the exported accounts.
+func (s *algodSource) block(round uint64) (algodBlock, error) {
+	s.mu.Lock()
+	cached, ok := s.blocks[round]
+	s.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	s.limiter.Wait()
+	block, err := s.client.Block(round)
+	if err != nil {
+		return algodBlock{}, fmt.Errorf("error looking up block %d: %w", round, err)
+	}
+	cached.timestamp = block.TimeStamp
+	for i, stxn := range block.Payset {
+		tx := blockTransaction(block, stxn.SignedTxnWithAD, uint64(i))
+		if stxn.HasGenesisID {
+			stxn.Txn.GenesisID = block.GenesisID
+		}
+		if stxn.HasGenesisHash {
+			stxn.Txn.GenesisHash = block.GenesisHash
+		}
+		tx.Id = crypto.TransactionIDString(stxn.Txn)
+
+		accounts := map[string]bool{}
+		transactionAccounts(tx, accounts)
+		for account := range accounts {
+			if !s.accounts[account] {
+				delete(accounts, account)
+			}
+		}
+		if len(accounts) > 0 {
+			cached.txns = append(cached.txns, algodTxn{tx: tx, accounts: accounts})
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blocks[round]; !ok {
+		s.blocks[round] = cached
+		s.rounds = append(s.rounds, round)
+		if len(s.rounds) > algodBlockCacheSize {
+			delete(s.blocks, s.rounds[0])
+			s.rounds = s.rounds[1:]
+		}
+	}
+	return cached, nil
+}
+
+func (s *algodSource) LookupAssetByID(assetID uint64) (models.Asset, error) {
+	s.limiter.Wait()
+	asset, err := s.client.AssetByID(assetID)
+	if err != nil {
+		return asset, fmt.Errorf("error looking up asset id: %w", err)
+	}
+	return asset, nil
+}
+
+// transactionAccounts adds the accounts a transaction (or any of its inner transactions) sends to,
+// receives from, closes to or freezes, the same accounts the indexer finds a transaction by.
+func transactionAccounts(tx models.Transaction, accounts map[string]bool) {
+	for _, account := range []string{
+		tx.Sender,
+		tx.PaymentTransaction.Receiver,
+		tx.PaymentTransaction.CloseRemainderTo,
+		tx.AssetTransferTransaction.Sender,
+		tx.AssetTransferTransaction.Receiver,
+		tx.AssetTransferTransaction.CloseTo,
+		tx.AssetFreezeTransaction.Address,
+	} {
+		if account != "" {
+			accounts[account] = true
+		}
+	}
+	for _, inner := range tx.InnerTxns {
+		transactionAccounts(inner, accounts)
+	}
+}
+
+func addressString(address types.Address) string {
+	if address.IsZero() {
+		return ""
+	}
+	return address.String()
+}
+
+var onCompletionNames = map[types.OnCompletion]string{
+	types.NoOpOC:              "noop",
+	types.OptInOC:             "optin",
+	types.CloseOutOC:          "closeout",
+	types.ClearStateOC:        "clear",
+	types.UpdateApplicationOC: "update",
+	types.DeleteApplicationOC: "delete",
+}
+
+// blockTransaction converts a block transaction to the indexer representation.
+// Inner transactions have no id, like the indexer.
+func blockTransaction(block types.Block, stxn types.SignedTxnWithAD, offset uint64) models.Transaction {
+	txn := stxn.Txn
+	tx := models.Transaction{
+		Type:             string(txn.Type),
+		Sender:           addressString(txn.Sender),
+		Fee:              uint64(txn.Fee),
+		FirstValid:       uint64(txn.FirstValid),
+		LastValid:        uint64(txn.LastValid),
+		Note:             txn.Note,
+		RekeyTo:          addressString(txn.RekeyTo),
+		AuthAddr:         addressString(stxn.AuthAddr),
+		ConfirmedRound:   uint64(block.Round),
+		RoundTime:        uint64(block.TimeStamp),
+		IntraRoundOffset: offset,
+
+		SenderRewards:   uint64(stxn.SenderRewards),
+		ReceiverRewards: uint64(stxn.ReceiverRewards),
+		CloseRewards:    uint64(stxn.CloseRewards),
+		ClosingAmount:   uint64(stxn.ClosingAmount),
+	}
+	if txn.Group != (types.Digest{}) {
+		tx.Group = append([]byte(nil), txn.Group[:]...)
+	}
+	if txn.Lease != ([32]byte{}) {
+		tx.Lease = append([]byte(nil), txn.Lease[:]...)
+	}
+
+	switch txn.Type {
+	case types.PaymentTx:
+		tx.PaymentTransaction = models.TransactionPayment{
+			Amount:           uint64(txn.Amount),
+			Receiver:         addressString(txn.Receiver),
+			CloseRemainderTo: addressString(txn.CloseRemainderTo),
+			CloseAmount:      uint64(stxn.ClosingAmount),
+		}
+	case types.AssetTransferTx:
+		tx.AssetTransferTransaction = models.TransactionAssetTransfer{
+			Amount:      txn.AssetAmount,
+			AssetId:     uint64(txn.XferAsset),
+			Receiver:    addressString(txn.AssetReceiver),
+			Sender:      addressString(txn.AssetSender),
+			CloseTo:     addressString(txn.AssetCloseTo),
+			CloseAmount: stxn.AssetClosingAmount,
+		}
+	case types.AssetConfigTx:
+		params := txn.AssetParams
+		tx.AssetConfigTransaction = models.TransactionAssetConfig{
+			AssetId: uint64(txn.ConfigAsset),
+			Params: models.AssetParams{
+				Total:         params.Total,
+				Decimals:      uint64(params.Decimals),
+				DefaultFrozen: params.DefaultFrozen,
+				UnitName:      params.UnitName,
+				Name:          params.AssetName,
+				Url:           params.URL,
+				Manager:       addressString(params.Manager),
+				Reserve:       addressString(params.Reserve),
+				Freeze:        addressString(params.Freeze),
+				Clawback:      addressString(params.Clawback),
+			},
+		}
+		if params.MetadataHash != ([32]byte{}) {
+			tx.AssetConfigTransaction.Params.MetadataHash = append([]byte(nil), params.MetadataHash[:]...)
+		}
+		tx.CreatedAssetIndex = stxn.ConfigAsset
+	case types.AssetFreezeTx:
+		tx.AssetFreezeTransaction = models.TransactionAssetFreeze{
+			Address:         addressString(txn.FreezeAccount),
+			AssetId:         uint64(txn.FreezeAsset),
+			NewFreezeStatus: txn.AssetFrozen,
+		}
+	case types.KeyRegistrationTx:
+		tx.KeyregTransaction = models.TransactionKeyreg{
+			NonParticipation: txn.Nonparticipation,
+			VoteFirstValid:   uint64(txn.VoteFirst),
+			VoteLastValid:    uint64(txn.VoteLast),
+			VoteKeyDilution:  txn.VoteKeyDilution,
+		}
+		if txn.VotePK != (types.VotePK{}) {
+			tx.KeyregTransaction.VoteParticipationKey = append([]byte(nil), txn.VotePK[:]...)
+		}
+		if txn.SelectionPK != (types.VRFPK{}) {
+			tx.KeyregTransaction.SelectionParticipationKey = append([]byte(nil), txn.SelectionPK[:]...)
+		}
+	case types.ApplicationCallTx:
+		appl := models.TransactionApplication{
+			ApplicationId:     uint64(txn.ApplicationID),
+			OnCompletion:      onCompletionNames[txn.OnCompletion],
+			ApplicationArgs:   txn.ApplicationArgs,
+			ApprovalProgram:   txn.ApprovalProgram,
+			ClearStateProgram: txn.ClearStateProgram,
+			ExtraProgramPages: uint64(txn.ExtraProgramPages),
+		}
+		for _, account := range txn.Accounts {
+			appl.Accounts = append(appl.Accounts, addressString(account))
+		}
+		for _, app := range txn.ForeignApps {
+			appl.ForeignApps = append(appl.ForeignApps, uint64(app))
+		}
+		for _, asset := range txn.ForeignAssets {
+			appl.ForeignAssets = append(appl.ForeignAssets, uint64(asset))
+		}
+		tx.ApplicationTransaction = appl
+		tx.CreatedApplicationIndex = stxn.ApplicationID
+	}
+
+	for _, log := range stxn.EvalDelta.Logs {
+		tx.Logs = append(tx.Logs, []byte(log))
+	}
+	for _, inner := range stxn.EvalDelta.InnerTxns {
+		tx.InnerTxns = append(tx.InnerTxns, blockTransaction(block, inner, offset))
+	}
+	return tx
+}
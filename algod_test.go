@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/algorand/go-algorand-sdk/crypto"
+	"github.com/algorand/go-algorand-sdk/types"
+)
+
+// fakeAlgod serves blocks from memory.
+type fakeAlgod struct {
+	blocks map[uint64]types.Block
+	last   uint64
+}
+
+func (f *fakeAlgod) LastRound() (uint64, error) {
+	return f.last, nil
+}
+
+func (f *fakeAlgod) Block(round uint64) (types.Block, error) {
+	block, ok := f.blocks[round]
+	if !ok {
+		block.Round = types.Round(round)
+		block.TimeStamp = int64(1672531200 + round)
+	}
+	return block, nil
+}
+
+func (f *fakeAlgod) AssetByID(assetID uint64) (models.Asset, error) {
+	return models.Asset{}, fmt.Errorf("asset id %d not found", assetID)
+}
+
+func mustDecodeAddress(t *testing.T, address string) types.Address {
+	decoded, err := types.DecodeAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestAlgodSource(t *testing.T) {
+	account := mustDecodeAddress(t, "HFTA36U4OCTSMXRUH4ZX3OACJBTJCR56AIH3G345TRPUQJHJBEXKLMMO4E")
+	other := mustDecodeAddress(t, "AV5EPTMH2RZJ2V72PR2WC63EMAMQOPKI2EDN4TU2XFA2WTAJN4VKKLODVI")
+	pool := types.Address{3}
+
+	genesisHash := types.Digest{1}
+	stxn := func(txn types.Transaction, ad types.ApplyData) types.SignedTxnInBlock {
+		return types.SignedTxnInBlock{
+			SignedTxnWithAD: types.SignedTxnWithAD{SignedTxn: types.SignedTxn{Txn: txn}, ApplyData: ad},
+			HasGenesisHash:  true,
+		}
+	}
+	pay := types.Transaction{
+		Type:             types.PaymentTx,
+		Header:           types.Header{Sender: account, Fee: 1000},
+		PaymentTxnFields: types.PaymentTxnFields{Receiver: other, Amount: 5000000},
+	}
+	unrelated := types.Transaction{
+		Type:             types.PaymentTx,
+		Header:           types.Header{Sender: other, Fee: 1000},
+		PaymentTxnFields: types.PaymentTxnFields{Receiver: pool, Amount: 1},
+	}
+	// The account only appears as the receiver of an inner transaction.
+	appl := types.Transaction{
+		Type:              types.ApplicationCallTx,
+		Header:            types.Header{Sender: other, Fee: 2000},
+		ApplicationFields: types.ApplicationFields{ApplicationCallTxnFields: types.ApplicationCallTxnFields{ApplicationID: 1002541853, OnCompletion: types.NoOpOC, ApplicationArgs: [][]byte{[]byte("swap")}}},
+	}
+	inner := types.SignedTxnWithAD{SignedTxn: types.SignedTxn{Txn: types.Transaction{
+		Type:                   types.AssetTransferTx,
+		Header:                 types.Header{Sender: pool},
+		AssetTransferTxnFields: types.AssetTransferTxnFields{XferAsset: 31566704, AssetAmount: 7, AssetReceiver: account},
+	}}}
+	// Closing out to the account.
+	closeOut := types.Transaction{
+		Type:             types.PaymentTx,
+		Header:           types.Header{Sender: pool, Fee: 1000},
+		PaymentTxnFields: types.PaymentTxnFields{Receiver: other, CloseRemainderTo: account},
+	}
+
+	algod := &fakeAlgod{last: 20, blocks: map[uint64]types.Block{
+		10: {BlockHeader: types.BlockHeader{Round: 10, TimeStamp: 1672531210, GenesisHash: genesisHash}, Payset: types.Payset{
+			stxn(pay, types.ApplyData{}),
+			stxn(unrelated, types.ApplyData{}),
+		}},
+		15: {BlockHeader: types.BlockHeader{Round: 15, TimeStamp: 1672531215, GenesisHash: genesisHash}, Payset: types.Payset{
+			stxn(appl, types.ApplyData{EvalDelta: types.EvalDelta{InnerTxns: []types.SignedTxnWithAD{inner}}}),
+			stxn(closeOut, types.ApplyData{ClosingAmount: 3000000}),
+		}},
+	}}
+	source := newAlgodSource(algod, nil, []string{account.String()})
+	source.pageSize = 1
+
+	var pages [][]models.Transaction
+	nextToken := ""
+	for {
+		response, err := source.LookupAccountTransactions(account.String(), transactionQuery{MinRound: 1}, nextToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.CurrentRound != 20 {
+			t.Errorf("CurrentRound: got %d, want 20", response.CurrentRound)
+		}
+		if len(response.Transactions) == 0 {
+			break
+		}
+		pages = append(pages, response.Transactions)
+		nextToken = response.NextToken
+	}
+
+	// Pages end with a whole block, newest first.
+	if len(pages) != 2 || len(pages[0]) != 2 || len(pages[1]) != 1 {
+		t.Fatalf("got pages %v", pages)
+	}
+	closed, called, paid := pages[0][0], pages[0][1], pages[1][0]
+
+	if closed.PaymentTransaction.CloseRemainderTo != account.String() || closed.PaymentTransaction.CloseAmount != 3000000 || closed.ClosingAmount != 3000000 {
+		t.Errorf("close out: got %+v", closed.PaymentTransaction)
+	}
+	if called.ApplicationTransaction.ApplicationId != 1002541853 || called.ApplicationTransaction.OnCompletion != "noop" || len(called.InnerTxns) != 1 {
+		t.Fatalf("application call: got %+v", called)
+	}
+	if innerTx := called.InnerTxns[0]; innerTx.Id != "" || innerTx.AssetTransferTransaction.Receiver != account.String() || innerTx.AssetTransferTransaction.AssetId != 31566704 || innerTx.ConfirmedRound != 15 {
+		t.Errorf("inner transaction: got %+v", innerTx)
+	}
+
+	pay.GenesisHash = genesisHash
+	if want := crypto.TransactionIDString(pay); paid.Id != want {
+		t.Errorf("id: got %s, want %s", paid.Id, want)
+	}
+	if paid.Sender != account.String() || paid.PaymentTransaction.Receiver != other.String() || paid.PaymentTransaction.CloseRemainderTo != "" || paid.RoundTime != 1672531210 || paid.ConfirmedRound != 10 {
+		t.Errorf("payment: got %+v", paid)
+	}
+
+	// A time window finds its last round with a binary search and stops at its first round.
+	response, err := source.LookupAccountTransactions(account.String(), transactionQuery{MinRound: 1, AfterTime: time.Unix(1672531212, 0), BeforeTime: time.Unix(1672531216, 0)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Transactions) != 2 || response.Transactions[1].Id != called.Id {
+		t.Errorf("time window: got %v", response.Transactions)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+// A dump directory holds the raw indexer responses of an export so it can be replayed offline:
+//
+//	<dir>/assets/<asset id>.json
+//	<dir>/accounts/<account>/page-<n>.json
+type dumpPage struct {
+	transactionQuery
+	NextToken string
+	Response  models.TransactionsResponse
+}
+
+func dumpAssetFile(dir string, assetID uint64) string {
+	return filepath.Join(dir, "assets", strconv.FormatUint(assetID, 10)+".json")
+}
+
+func dumpAccountDir(dir string, account string) string {
+	return filepath.Join(dir, "accounts", account)
+}
+
+func writeJSONFile(file string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+func readJSONFile(file string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// recordSource wraps a transactionSource and saves every response to a dump directory.
+type recordSource struct {
+	source transactionSource
+	dir    string
+
+	mu    sync.Mutex
+	pages map[string]int
+}
+
+func newRecordSource(source transactionSource, dir string) *recordSource {
+	return &recordSource{
+		source: source,
+		dir:    dir,
+		pages:  map[string]int{},
+	}
+}
+
+func (s *recordSource) LookupAccountTransactions(account string, query transactionQuery, nextToken string) (models.TransactionsResponse, error) {
+	transactions, err := s.source.LookupAccountTransactions(account, query, nextToken)
+	if err != nil {
+		return transactions, err
+	}
+
+	// Start a new recording of the account on the first page.
+	if nextToken == "" {
+		if err := os.RemoveAll(dumpAccountDir(s.dir, account)); err != nil {
+			return transactions, fmt.Errorf("unable to reset recording for account %s: %w", account, err)
+		}
+	}
+	s.mu.Lock()
+	if nextToken == "" {
+		s.pages[account] = 0
+	}
+	s.pages[account]++
+	pageNum := s.pages[account]
+	s.mu.Unlock()
+
+	page := dumpPage{
+		transactionQuery: query,
+		NextToken:        nextToken,
+		Response:         transactions,
+	}
+	file := filepath.Join(dumpAccountDir(s.dir, account), fmt.Sprintf("page-%d.json", pageNum))
+	if err := writeJSONFile(file, page); err != nil {
+		return transactions, fmt.Errorf("unable to record transactions: %w", err)
+	}
+	return transactions, nil
+}
+
+func (s *recordSource) LookupAssetByID(assetID uint64) (models.Asset, error) {
+	asset, err := s.source.LookupAssetByID(assetID)
+	if err != nil {
+		return asset, err
+	}
+	if err := writeJSONFile(dumpAssetFile(s.dir, assetID), asset); err != nil {
+		return asset, fmt.Errorf("unable to record asset id %d: %w", assetID, err)
+	}
+	return asset, nil
+}
+
+// replaySource serves transactions and assets from a dump directory without any network access.
+// Pages are matched by their NextToken, so the export walks the history exactly as it was recorded.
+type replaySource struct {
+	dir string
+
+	mu    sync.Mutex
+	pages map[string]map[string]dumpPage
+}
+
+func newReplaySource(dir string) (*replaySource, error) {
+	if !fileExist(dir) {
+		return nil, fmt.Errorf("replay directory %s does not exist", dir)
+	}
+	return &replaySource{
+		dir:   dir,
+		pages: map[string]map[string]dumpPage{},
+	}, nil
+}
+
+func (s *replaySource) loadAccount(account string) (map[string]dumpPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pages, ok := s.pages[account]; ok {
+		return pages, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dumpAccountDir(s.dir, account), "page-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded transactions for account %s in %s", account, s.dir)
+	}
+	pages := map[string]dumpPage{}
+	for _, file := range files {
+		var page dumpPage
+		if err := readJSONFile(file, &page); err != nil {
+			return nil, fmt.Errorf("unable to read recorded page %s: %w", file, err)
+		}
+		pages[page.NextToken] = page
+	}
+	s.pages[account] = pages
+	return pages, nil
+}
+
+// LookupAccountTransactions ignores the query and replays the account from the start of the recording.
+func (s *replaySource) LookupAccountTransactions(account string, query transactionQuery, nextToken string) (models.TransactionsResponse, error) {
+	pages, err := s.loadAccount(account)
+	if err != nil {
+		return models.TransactionsResponse{}, err
+	}
+	page, ok := pages[nextToken]
+	if !ok {
+		return models.TransactionsResponse{}, fmt.Errorf("no recorded page for account %s with next token %q", account, nextToken)
+	}
+	return page.Response, nil
+}
+
+func (s *replaySource) LookupAssetByID(assetID uint64) (models.Asset, error) {
+	var asset models.Asset
+	if err := readJSONFile(dumpAssetFile(s.dir, assetID), &asset); err != nil {
+		return asset, fmt.Errorf("no recorded asset id %d: %w", assetID, err)
+	}
+	return asset, nil
+}
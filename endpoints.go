@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/algod"
+	"github.com/algorand/go-algorand-sdk/client/v2/common"
+	"github.com/algorand/go-algorand-sdk/client/v2/indexer"
+)
+
+const (
+	endpointIndexer = "indexer"
+	endpointAlgod   = "algod"
+)
+
+// defaultEndpointsFile is the endpoint profiles file used when no -endpoints path is given.
+func defaultEndpointsFile() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "algo-csv-endpoints.json")
+}
+
+// endpointConfig is the endpoint profiles file, e.g.:
+//
+//	{
+//	  "profiles": {
+//	    "provider": {
+//	      "url": "https://mainnet-idx.example.com",
+//	      "tokenHeader": "X-API-Key",
+//	      "tokenEnv": "PROVIDER_API_KEY",
+//	      "rate": 10
+//	    }
+//	  }
+//	}
+type endpointConfig struct {
+	Profiles map[string]endpointProfile `json:"profiles"`
+}
+
+// endpointProfile is a named indexer or algod endpoint.
+type endpointProfile struct {
+	Type        string            `json:"type,omitempty"`   // "indexer" (default) or "algod".
+	URL         string            `json:"url"`              // Base URL of the API.
+	Scheme      string            `json:"scheme,omitempty"` // Scheme used when URL has none, "https" by default.
+	TokenHeader string            `json:"tokenHeader,omitempty"`
+	Token       string            `json:"token,omitempty"`
+	TokenEnv    string            `json:"tokenEnv,omitempty"` // Environment variable holding the token, instead of Token.
+	Headers     map[string]string `json:"headers,omitempty"`
+	TLS         endpointTLS       `json:"tls,omitempty"`
+	Rate        *float64          `json:"rate,omitempty"` // Requests per second, 0 for no limit.
+	Burst       int               `json:"burst,omitempty"`
+}
+
+type endpointTLS struct {
+	CAFile             string `json:"caFile,omitempty"` // PEM CA bundle trusted in addition to the system roots.
+	CertFile           string `json:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// loadEndpoints loads the endpoint profiles file.
+func loadEndpoints(file string) (endpointConfig, error) {
+	var config endpointConfig
+	if err := readJSONFile(file, &config); err != nil {
+		return config, fmt.Errorf("unable to read endpoint profiles %s: %w", file, err)
+	}
+	return config, nil
+}
+
+func (c endpointConfig) names() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profile returns the named profile.
+func (c endpointConfig) profile(name string) (endpointProfile, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return profile, fmt.Errorf("unknown endpoint profile %q, valid profiles are: %s", name, strings.Join(c.names(), ", "))
+	}
+	switch profile.Type {
+	case "":
+		profile.Type = endpointIndexer
+	case endpointIndexer, endpointAlgod:
+	default:
+		return profile, fmt.Errorf("endpoint profile %q has unknown type %q", name, profile.Type)
+	}
+	if profile.URL == "" {
+		return profile, fmt.Errorf("endpoint profile %q has no url", name)
+	}
+	return profile, nil
+}
+
+// address returns the URL of the profile, adding the scheme if it has none.
+func (p endpointProfile) address() (string, error) {
+	address := p.URL
+	if !strings.Contains(address, "://") {
+		scheme := p.Scheme
+		if scheme == "" {
+			scheme = "https"
+		}
+		address = scheme + "://" + address
+	}
+	serverAddr, err := url.Parse(address)
+	if err != nil {
+		return "", fmt.Errorf("error in server address: %w", err)
+	}
+	return serverAddr.String(), nil
+}
+
+func (p endpointProfile) token() string {
+	if p.TokenEnv != "" {
+		return os.Getenv(p.TokenEnv)
+	}
+	return p.Token
+}
+
+func (p endpointProfile) tokenHeader() string {
+	switch {
+	case p.TokenHeader != "":
+		return p.TokenHeader
+	case p.Type == endpointAlgod:
+		return "X-Algo-API-Token"
+	}
+	return "X-Indexer-API-Token"
+}
+
+// rateLimiter returns the rate limiter of the profile, using rate and burst if the profile has no limit.
+// The default rate is the limit of hosted indexers, so algod profiles have no limit unless they set one:
+// walking blocks takes at least a request per round.
+func (p endpointProfile) rateLimiter(rate float64, burst int) *rateLimiter {
+	if p.Type == endpointAlgod {
+		rate = 0
+	}
+	if p.Rate != nil {
+		rate = *p.Rate
+	}
+	if p.Burst != 0 {
+		burst = p.Burst
+	}
+	return newRateLimiter(rate, burst)
+}
+
+// client returns an API client for the profile, to be converted to an *indexer.Client or *algod.Client.
+func (p endpointProfile) client() (*common.Client, error) {
+	address, err := p.address()
+	if err != nil {
+		return nil, err
+	}
+	if err := configureTLS(p.TLS); err != nil {
+		return nil, err
+	}
+	var headers []*common.Header
+	for key, value := range p.Headers {
+		headers = append(headers, &common.Header{Key: key, Value: value})
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Key < headers[j].Key })
+	client, err := common.MakeClientWithHeaders(address, p.tokenHeader(), p.token(), headers)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s client: %w", p.Type, err)
+	}
+	return client, nil
+}
+
+// newEndpointSource returns the transactionSource of the profile.
+// accounts are the exported accounts, which an algod source filters the blocks for.
+func newEndpointSource(profile endpointProfile, limiter *rateLimiter, accounts []string) (transactionSource, error) {
+	client, err := profile.client()
+	if err != nil {
+		return nil, err
+	}
+	if profile.Type == endpointAlgod {
+		return newAlgodSource(&algodNode{client: (*algod.Client)(client)}, limiter, accounts), nil
+	}
+	return newIndexerSource((*indexer.Client)(client), limiter), nil
+}
+
+// configureTLS applies the TLS options to http.DefaultTransport, which the SDK clients always use.
+// Only one endpoint is used per run, so the options apply to it alone.
+func configureTLS(options endpointTLS) error {
+	if options == (endpointTLS{}) {
+		return nil
+	}
+	transport, ok := defaultTransport()
+	if !ok {
+		return fmt.Errorf("unable to configure TLS for the default HTTP transport")
+	}
+	config := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+	if options.CAFile != "" {
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return fmt.Errorf("unable to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = config
+	return nil
+}
+
+// defaultTransport returns the *http.Transport behind http.DefaultTransport.
+func defaultTransport() (*http.Transport, bool) {
+	switch transport := http.DefaultTransport.(type) {
+	case *http.Transport:
+		return transport, true
+	case *statusTransport:
+		return transport.base, true
+	}
+	return nil, false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEndpointProfile(t *testing.T) {
+	var gotHeaders http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header
+		fmt.Fprint(w, `{"asset": {"index": 31566704, "params": {"unit-name": "USDC"}}, "current-round": 1}`)
+	}))
+	defer server.Close()
+	transport, _ := defaultTransport()
+	defer func(config *tls.Config) { transport.TLSClientConfig = config }(transport.TLSClientConfig)
+
+	dir, err := ioutil.TempDir("", "endpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	endpointsFile := filepath.Join(dir, "endpoints.json")
+	if err := writeJSONFile(endpointsFile, map[string]interface{}{
+		"profiles": map[string]interface{}{
+			"provider": map[string]interface{}{
+				"url":         strings.TrimPrefix(server.URL, "https://"),
+				"tokenHeader": "X-API-Key",
+				"tokenEnv":    "ALGO_EXPORT_TEST_TOKEN",
+				"headers":     map[string]string{"X-Tenant": "tax"},
+				"tls":         map[string]string{"caFile": caFile},
+				"rate":        0,
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("ALGO_EXPORT_TEST_TOKEN", "secret")
+	defer os.Unsetenv("ALGO_EXPORT_TEST_TOKEN")
+
+	config, err := loadEndpoints(endpointsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.profile("missing"); err == nil || !strings.Contains(err.Error(), "provider") {
+		t.Errorf("expected an error listing the valid profiles, got %v", err)
+	}
+	profile, err := config.profile("provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Type != endpointIndexer {
+		t.Errorf("type: got %q, want %q", profile.Type, endpointIndexer)
+	}
+	if limiter := profile.rateLimiter(0.5, 1); limiter.rate != 0 {
+		t.Errorf("rate: got %v, want the profile rate 0", limiter.rate)
+	}
+	if limiter := (endpointProfile{Type: endpointAlgod}).rateLimiter(0.5, 1); limiter.rate != 0 {
+		t.Errorf("algod rate: got %v, want no limit", limiter.rate)
+	}
+	rate := 2.0
+	if limiter := (endpointProfile{Type: endpointAlgod, Rate: &rate}).rateLimiter(0.5, 1); limiter.rate != 2 {
+		t.Errorf("algod rate: got %v, want the profile rate 2", limiter.rate)
+	}
+
+	source, err := newEndpointSource(profile, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset, err := source.LookupAssetByID(31566704)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Index != 31566704 || asset.Params.UnitName != "USDC" {
+		t.Errorf("got asset %d %q", asset.Index, asset.Params.UnitName)
+	}
+	for header, want := range map[string]string{"X-Api-Key": "secret", "X-Tenant": "tax"} {
+		if got := gotHeaders.Get(header); got != want {
+			t.Errorf("header %s: got %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/algorand/go-algorand-sdk/types"
+	"github.com/m4dc0w/algo-export/exporter"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// pagedSource serves the fixture transactions one page of pageSize transactions at a time.
+// failPage makes the lookup of that page fail once, as if the export was interrupted.
+type pagedSource struct {
+	*fixtureSource
+	transactions []models.Transaction
+	pageSize     int
+	failPage     int
+	lookups      int
+}
+
+func (s *pagedSource) LookupAccountTransactions(account string, query transactionQuery, nextToken string) (models.TransactionsResponse, error) {
+	s.lookups++
+	page := 0
+	if nextToken != "" {
+		fmt.Sscanf(nextToken, "page-%d", &page)
+	}
+	if s.failPage != 0 && page == s.failPage {
+		s.failPage = 0
+		return models.TransactionsResponse{}, errInterrupted
+	}
+	response := models.TransactionsResponse{CurrentRound: 1000}
+	start := page * s.pageSize
+	if start < len(s.transactions) {
+		end := start + s.pageSize
+		if end > len(s.transactions) {
+			end = len(s.transactions)
+		}
+		response.Transactions = s.transactions[start:end]
+		response.NextToken = fmt.Sprintf("page-%d", page+1)
+	}
+	return response, nil
+}
+
+func TestExportResumesFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture, assets := loadFixture(t, filepath.Join("testdata", "golden", "tinyman_v2_liquidity.json"))
+	algoFi, _ := loadFixture(t, filepath.Join("testdata", "golden", "algofi_lend.json"))
+	for _, asset := range algoFi.Assets {
+		assets.assets[asset.Index] = asset
+	}
+	transactions := append(fixture.Transactions, algoFi.Transactions...)
+	address, err := types.DecodeAddress(fixture.Account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(name string, failPage int) ([]byte, *pagedSource, error) {
+		options := exportOptions{
+			outDir:    filepath.Join(dir, name),
+			stateFile: filepath.Join(dir, name, "state.json"),
+			workers:   1,
+			resume:    true,
+		}
+		if err := os.MkdirAll(options.outDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		// Groups span pages with a page size of 1.
+		source := &pagedSource{fixtureSource: assets, transactions: transactions, pageSize: 1, failPage: failPage}
+		err := exportAccounts(source, exporter.NewcointrackingExporter(), accountList{address}, options)
+		csv, _ := ioutil.ReadFile(filepath.Join(options.outDir, fmt.Sprintf("cointracking-%s-1-1000.csv", fixture.Account)))
+		return csv, source, err
+	}
+
+	want, _, err := export("uninterrupted", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := export("resumed", 4); !errors.Is(err, errInterrupted) {
+		t.Fatalf("got error %v, want %v", err, errInterrupted)
+	}
+	exportState, err := LoadConfig(filepath.Join(dir, "resumed", "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountState := exportState.ForAccount("cointracking", fixture.Account)
+	if accountState.LastRound != 0 || accountState.Checkpoint == nil || accountState.Checkpoint.Pages != 4 {
+		t.Fatalf("got state %+v, checkpoint %+v", accountState, accountState.Checkpoint)
+	}
+
+	// A run killed before it could unlock the state leaves its lock behind, which is stale once the process is gone.
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lockFile := filepath.Join(dir, "resumed", "state.json.lock")
+	if err := ioutil.WriteFile(lockFile, []byte(fmt.Sprintf("%d\n", exited.Process.Pid)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, source, err := export("resumed", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the pages after the checkpoint are looked up again, including the final empty page.
+	if wantLookups := len(transactions) - 4 + 1; source.lookups != wantLookups {
+		t.Errorf("lookups: got %d, want %d", source.lookups, wantLookups)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("resumed export does not match\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	exportState, err = LoadConfig(filepath.Join(dir, "resumed", "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountState = exportState.ForAccount("cointracking", fixture.Account)
+	if accountState.LastRound != 1000 || accountState.Checkpoint != nil {
+		t.Errorf("got state %+v, checkpoint %+v", accountState, accountState.Checkpoint)
+	}
+	if fileExist(checkpointDirFor(filepath.Join(dir, "resumed", "state.json"), "cointracking", fixture.Account)) {
+		t.Error("expected the checkpoint directory to be removed")
+	}
+	if fileExist(lockFile) {
+		t.Error("expected the state to be unlocked")
+	}
+}
+
+func TestExportWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The rewards fixture is in December 2021, the Tinyman fixture on 2023-01-01.
+	fixture, assets := loadFixture(t, filepath.Join("testdata", "golden", "tinyman_v2_liquidity.json"))
+	rewards, _ := loadFixture(t, filepath.Join("testdata", "golden", "rewards_airdrops.json"))
+	for _, asset := range rewards.Assets {
+		assets.assets[asset.Index] = asset
+	}
+	address, err := types.DecodeAddress(fixture.Account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	window, err := parseExportWindow(0, 0, "2021-01-01", "2022-12-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := exportOptions{outDir: dir, workers: 1, window: window}
+	source := &pagedSource{fixtureSource: assets, transactions: append(fixture.Transactions, rewards.Transactions...), pageSize: 3}
+	if err := exportAccounts(source, exporter.NewcointrackingExporter(), accountList{address}, options); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("cointracking-%s-2021-01-01-2022-12-31.csv", fixture.Account)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("testdata", "golden", "rewards_airdrops.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("window export does not match\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := parseExportWindow(10, 5, "", ""); err == nil {
+		t.Error("expected an error for a start round after the end round")
+	}
+
+	// The lots of a range which does not start with the account's history are incomplete.
+	options.gainsMethod = exporter.FIFO
+	if err := exportAccounts(source, exporter.NewcointrackingExporter(), accountList{address}, options); err == nil {
+		t.Error("expected an error for a gains report of a range export")
+	}
+	if options.window, err = parseExportWindow(0, 30000000, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportAccounts(source, exporter.NewcointrackingExporter(), accountList{address}, options); err != nil {
+		t.Errorf("a gains report of a range starting with the first round failed: %v", err)
+	}
+}
+
+func TestExportKeepsGainsLots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture, assets := loadFixture(t, filepath.Join("testdata", "golden", "tinyman_v2_liquidity.json"))
+	address, err := types.DecodeAddress(fixture.Account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(dir, "state.json")
+	export := func(gainsMethod exporter.LotMethod) error {
+		options := exportOptions{outDir: dir, stateFile: stateFile, workers: 1, gainsMethod: gainsMethod}
+		source := &pagedSource{fixtureSource: assets, transactions: fixture.Transactions, pageSize: 10}
+		return exportAccounts(source, exporter.NewcointrackingExporter(), accountList{address}, options)
+	}
+
+	// The lots of every method are updated without -gains.
+	if err := export(""); err != nil {
+		t.Fatal(err)
+	}
+	exportState, err := LoadConfig(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountState := exportState.ForAccount("cointracking", fixture.Account)
+	if accountState.LotsRound != 1000 || len(accountState.Lots) != len(exporter.LotMethods()) {
+		t.Fatalf("got lots round %d, lots %v", accountState.LotsRound, accountState.Lots)
+	}
+	if err := export(exporter.HIFO); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lots behind the exported rounds are refused for a gains report.
+	accountState.LotsRound = 500
+	if err := exportState.SaveConfig(stateFile, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := export(exporter.FIFO); err == nil || !strings.Contains(err.Error(), "built to round 500") {
+		t.Errorf("got error %v, want the lots to be refused", err)
+	}
+}
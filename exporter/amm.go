@@ -0,0 +1,263 @@
+package exporter
+
+// applRecords splits the records of an application group into deposits, withdrawals and fees.
+// Deposits and withdrawals are returned with their index in records.
+type applRecords struct {
+	deposits    []int
+	withdrawals []int
+	fees        []int
+	others      []int
+}
+
+func splitApplRecords(records []ExportRecord) applRecords {
+	var split applRecords
+	for i, r := range records {
+		switch {
+		case r.reward:
+			split.others = append(split.others, i)
+		case r.feeTx:
+			split.fees = append(split.fees, i)
+		case r.IsDeposit():
+			split.deposits = append(split.deposits, i)
+		case r.IsWithdrawal():
+			split.withdrawals = append(split.withdrawals, i)
+		default:
+			split.others = append(split.others, i)
+		}
+	}
+	return split
+}
+
+// appendApplFees appends the fees of an application group, as other fees, and its other records to processed.
+func appendApplFees(processed []ExportRecord, records []ExportRecord, split applRecords) []ExportRecord {
+	for _, i := range split.fees {
+		r := records[i]
+		r.otherFee = true
+		processed = append(processed, r)
+	}
+	for _, i := range split.others {
+		processed = append(processed, records[i])
+	}
+	return processed
+}
+
+// ammSwap exports the swap of an AMM pool as a trade, ok is false if the records are not a swap.
+// Fixed-output swaps refund the unused input in a second deposit.
+func ammSwap(records []ExportRecord, split applRecords, comment string) (processed []ExportRecord, ok bool) {
+	if len(split.withdrawals) != 1 || len(split.deposits) < 1 || len(split.deposits) > 2 {
+		return nil, false
+	}
+	input := records[split.withdrawals[0]]
+	var output ExportRecord
+	var refund uint64
+	for _, i := range split.deposits {
+		r := records[i]
+		if r.recvASA == input.sentASA && len(split.deposits) == 2 {
+			refund += r.recvQty
+			continue
+		}
+		output = r
+	}
+	if output.recvQty == 0 || refund >= input.sentQty {
+		return nil, false
+	}
+	r := output
+	r.appl = true
+	r.trade = true
+	r.sentQty = input.sentQty - refund
+	r.sentASA = input.sentASA
+	if input.sentASA == 0 {
+		r.fee = input.fee // Put fees in same record when trading ALGO -> ASA.
+	}
+	r.comment = comment
+	processed = append(processed, r)
+	return appendApplFees(processed, records, split), true
+}
+
+// ammAddLiquidity exports adding one or both assets to an AMM pool as a split trade of each asset for its
+// share of the pool tokens, ok is false if the records are not a deposit.
+// https://cointracking.freshdesk.com/en/support/solutions/articles/29000038185-how-are-liquidity-pool-transactions-imported-
+func ammAddLiquidity(records []ExportRecord, split applRecords, comment string) (processed []ExportRecord, ok bool) {
+	if len(split.deposits) != 1 || len(split.withdrawals) < 1 || len(split.withdrawals) > 2 {
+		return nil, false
+	}
+	pool := records[split.deposits[0]]
+	var poolQty uint64
+	for n, i := range split.withdrawals {
+		w := records[i]
+		r := pool
+		r.txid = w.txid
+		r.topTxID = w.topTxID // Keep an unique id for each split trade.
+		r.appl = true
+		r.trade = true
+		r.recvQty = pool.recvQty / uint64(len(split.withdrawals))
+		if n == len(split.withdrawals)-1 {
+			r.recvQty = pool.recvQty - poolQty // Original qty could be an odd number, so use subtraction.
+		}
+		poolQty += r.recvQty
+		r.sentQty = w.sentQty
+		r.sentASA = w.sentASA
+		if w.sentASA == 0 {
+			r.fee = w.fee // Put fees in same record when trading ALGO -> ASA.
+		}
+		r.comment = comment
+		processed = append(processed, r)
+	}
+	return appendApplFees(processed, records, split), true
+}
+
+// ammRemoveLiquidity exports removing liquidity from an AMM pool to one or both of its assets as a split trade
+// of the pool tokens, ok is false if the records are not a withdrawal.
+func ammRemoveLiquidity(records []ExportRecord, split applRecords, comment string) (processed []ExportRecord, ok bool) {
+	if len(split.withdrawals) != 1 || len(split.deposits) < 1 || len(split.deposits) > 2 {
+		return nil, false
+	}
+	pool := records[split.withdrawals[0]]
+	var poolQty uint64
+	for n, i := range split.deposits {
+		d := records[i]
+		r := pool
+		r.txid = d.txid
+		r.topTxID = d.topTxID
+		r.appl = true
+		r.trade = true
+		r.sentQty = pool.sentQty / uint64(len(split.deposits))
+		if n == len(split.deposits)-1 {
+			r.sentQty = pool.sentQty - poolQty // Original qty could be an odd number, so use subtraction.
+		}
+		poolQty += r.sentQty
+		r.recvQty = d.recvQty
+		r.recvASA = d.recvASA
+		r.comment = comment
+		processed = append(processed, r)
+	}
+	return appendApplFees(processed, records, split), true
+}
+
+// ammAggregatedSwap nets the records of a swap routed through several pools down to a single trade of the input
+// asset for the output asset, ok is false if the records are not a swap.
+// The input asset is the asset the account sent more of than it received, ALGO only if no other asset was sent
+// (e.g. an aggregator fee in ALGO). The output asset is the asset the account received and never sent. Any other
+// asset lost on the route (aggregator fees, intermediate legs) is an other fee, and any other asset left over
+// is exported as received. With an ALGO input, the largest ALGO payment is the route and any other ALGO payment
+// is an aggregator fee.
+func ammAggregatedSwap(records []ExportRecord, split applRecords, comment string) (processed []ExportRecord, ok bool) {
+	type assetNet struct {
+		recv, sent uint64
+		deposit    int // Index of a deposit of the asset, -1 if none.
+		withdrawal int // Index of a withdrawal of the asset, -1 if none.
+	}
+	var assets []uint64 // In order of appearance.
+	nets := map[uint64]*assetNet{}
+	net := func(assetID uint64) *assetNet {
+		n, ok := nets[assetID]
+		if !ok {
+			n = &assetNet{deposit: -1, withdrawal: -1}
+			nets[assetID] = n
+			assets = append(assets, assetID)
+		}
+		return n
+	}
+	var algoFees uint64
+	var algoPayments []int
+	for _, i := range split.withdrawals {
+		r := records[i]
+		n := net(r.sentASA)
+		n.sent += r.sentQty
+		if n.withdrawal < 0 {
+			n.withdrawal = i
+		}
+		if r.sentASA == 0 {
+			algoFees += r.fee
+			algoPayments = append(algoPayments, i)
+		}
+	}
+	for _, i := range split.deposits {
+		r := records[i]
+		n := net(r.recvASA)
+		n.recv += r.recvQty
+		if n.deposit < 0 {
+			n.deposit = i
+		}
+	}
+
+	var inputs, outputs []uint64
+	for _, assetID := range assets {
+		n := nets[assetID]
+		if n.sent > n.recv {
+			inputs = append(inputs, assetID)
+		}
+		if n.recv > n.sent && n.withdrawal < 0 {
+			outputs = append(outputs, assetID)
+		}
+	}
+	if len(inputs) == 2 && (inputs[0] == 0 || inputs[1] == 0) {
+		// The ALGO sent with an ASA input pays the aggregator fee.
+		if inputs[0] == 0 {
+			inputs = inputs[1:]
+		} else {
+			inputs = inputs[:1]
+		}
+	}
+	if len(inputs) != 1 || len(outputs) != 1 {
+		return nil, false
+	}
+	input, output := nets[inputs[0]], nets[outputs[0]]
+
+	r := records[output.deposit]
+	r.appl = true
+	r.trade = true
+	r.recvQty = output.recv
+	r.sentQty = input.sent - input.recv
+	r.sentASA = inputs[0]
+	r.fee = 0
+	var fees []ExportRecord
+	if inputs[0] == 0 {
+		route := algoPayments[0]
+		for _, i := range algoPayments[1:] {
+			if records[i].sentQty > records[route].sentQty {
+				route = i
+			}
+		}
+		if input.recv >= records[route].sentQty {
+			return nil, false
+		}
+		r.sentQty = records[route].sentQty - input.recv
+		r.fee = records[route].fee // Put fees in same record when trading ALGO -> ASA.
+		for _, i := range algoPayments {
+			if i == route {
+				continue
+			}
+			fee := records[i]
+			fee.otherFee = true
+			fee.comment = comment + " - Fee"
+			fees = append(fees, fee)
+		}
+	}
+	r.comment = comment
+	processed = append(processed, r)
+	processed = append(processed, fees...)
+
+	for _, assetID := range assets {
+		n := nets[assetID]
+		switch {
+		case assetID == inputs[0] || assetID == outputs[0] || n.sent == n.recv:
+		case n.sent > n.recv:
+			fee := records[n.withdrawal]
+			fee.sentQty = n.sent - n.recv
+			fee.fee = 0
+			if assetID == 0 {
+				fee.fee = algoFees
+			}
+			fee.otherFee = true
+			fee.comment = comment + " - Fee"
+			processed = append(processed, fee)
+		default:
+			remainder := records[n.deposit]
+			remainder.recvQty = n.recv - n.sent
+			remainder.comment = comment + " - Remainder"
+			processed = append(processed, remainder)
+		}
+	}
+	return appendApplFees(processed, records, split), true
+}
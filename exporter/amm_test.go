@@ -0,0 +1,262 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func TestAMMHandlers(t *testing.T) {
+	const usdc, lp = 31566704, 999
+	assetMap := map[uint64]models.Asset{
+		usdc: {Index: usdc, Params: models.AssetParams{UnitName: "USDC", Decimals: 6}},
+		lp:   {Index: lp, Params: models.AssetParams{UnitName: "LP", Decimals: 6}},
+	}
+	type trade struct {
+		recvASA, recvQty, sentASA, sentQty uint64
+	}
+	for _, test := range []struct {
+		name    string
+		process func(records []ExportRecord, txns []models.Transaction) ([]ExportRecord, error)
+		txns    []models.Transaction
+		want    []trade
+	}{
+		{"pact swap", ApplPact, applGroup(1, "SWAP", transfer("POOL", testAccount, usdc, 300), transfer(testAccount, "POOL", 0, 1000)),
+			[]trade{{usdc, 300, 0, 1000}}},
+		{"pact add liquidity", ApplPact, applGroup(1, "ADDLIQ", transfer("POOL", testAccount, lp, 51), transfer(testAccount, "POOL", usdc, 300), transfer(testAccount, "POOL", 0, 1000)),
+			[]trade{{lp, 25, usdc, 300}, {lp, 26, 0, 1000}}},
+		{"pact remove liquidity", ApplPact, applGroup(1, "REMLIQ", transfer("POOL", testAccount, usdc, 300), transfer("POOL", testAccount, 0, 1000), transfer(testAccount, "POOL", lp, 51)),
+			[]trade{{usdc, 300, lp, 25}, {0, 1000, lp, 26}}},
+		{"humble swap with refund", ApplHumbleSwap, applGroup(2, "", transfer("POOL", testAccount, 0, 100), transfer("POOL", testAccount, usdc, 300), transfer(testAccount, "POOL", 0, 1100)),
+			[]trade{{usdc, 300, 0, 1000}}},
+		{"humble remove liquidity", ApplHumbleSwap, applGroup(2, "", transfer("POOL", testAccount, usdc, 300), transfer("POOL", testAccount, 0, 1000), transfer(testAccount, "POOL", lp, 50)),
+			[]trade{{usdc, 300, lp, 25}, {0, 1000, lp, 25}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			processed, err := test.process(filterGroup(t, test.txns, assetMap), test.txns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []trade
+			for _, r := range processed {
+				if r.trade {
+					got = append(got, trade{r.recvASA, r.recvQty, r.sentASA, r.sentQty})
+				} else if !r.feeTx {
+					t.Errorf("unexpected record %+v", r)
+				}
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got trades %+v, want %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("trade %d: got %+v, want %+v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+
+	// Pact pools are matched by the shape of their application call.
+	amount := make([]byte, 8)
+	for _, test := range []struct {
+		appl models.TransactionApplication
+		want bool
+	}{
+		{models.TransactionApplication{ApplicationId: 1, ApplicationArgs: [][]byte{[]byte("SWAP"), amount}, ForeignAssets: []uint64{usdc}}, true},
+		{models.TransactionApplication{ApplicationId: 1, ApplicationArgs: [][]byte{[]byte("REMLIQ"), amount, amount}, ForeignAssets: []uint64{usdc, lp}}, true},
+		{models.TransactionApplication{ApplicationId: 1, ApplicationArgs: [][]byte{[]byte("swap"), amount}, ForeignAssets: []uint64{usdc}}, false},
+		{models.TransactionApplication{ApplicationId: 1, ApplicationArgs: [][]byte{[]byte("SWAP")}, ForeignAssets: []uint64{usdc}}, false},
+		{models.TransactionApplication{ApplicationId: 1, ApplicationArgs: [][]byte{[]byte("SWAP"), []byte("x")}, ForeignAssets: []uint64{usdc}}, false},
+		{models.TransactionApplication{ApplicationId: 1, ApplicationArgs: [][]byte{[]byte("SWAP"), amount}}, false},
+	} {
+		handler, ok := findApplHandler(test.appl, nil)
+		if got := ok && handler.name == "Pact"; got != test.want {
+			t.Errorf("%s: got handler %q, want Pact %v", test.appl.ApplicationArgs[0], handler.name, test.want)
+		}
+	}
+
+	// HumbleSwap pools which are not listed are matched by the ABI method selector of their call.
+	var swapAForB string
+	for selector, signature := range humbleMethods {
+		if signature == "Trader_swapAForB(uint64,uint64)(uint64,uint64)" {
+			swapAForB = selector
+		}
+	}
+	txns := applGroup(123456789, swapAForB, transfer("POOL", testAccount, usdc, 300), transfer(testAccount, "POOL", 0, 1000))
+	handler, ok := findApplHandler(txns[0].ApplicationTransaction, txns)
+	if !ok || handler.name != "HumbleSwap" {
+		t.Fatalf("got handler %q, want HumbleSwap", handler.name)
+	}
+	processed, err := handler.process(filterGroup(t, txns, assetMap), txns, assetMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := processed[0]; !r.trade || r.recvASA != usdc || r.recvQty != 300 || r.sentQty != 1000 {
+		t.Errorf("got %+v, want a swap of 1000 ALGO for 300 USDC", r)
+	}
+	if _, ok := findApplHandler(models.TransactionApplication{ApplicationId: 123456789, ApplicationArgs: [][]byte{[]byte("noop")}}, nil); ok {
+		t.Error("expected no handler for another method")
+	}
+}
+
+func TestAggregatorSwap(t *testing.T) {
+	const usdc, gobtc, out = 31566704, 386192725, 777
+	assetMap := map[uint64]models.Asset{}
+	for _, id := range []uint64{usdc, gobtc, out} {
+		assetMap[id] = models.Asset{Index: id, Params: models.AssetParams{UnitName: "ASA", Decimals: 6}}
+	}
+	// Newest first: the output, an intermediate leg leaving 1 goBTC, the aggregator fee in ALGO and the input.
+	txns := applGroup(989365103, "swap",
+		transfer("ROUTER", testAccount, out, 700),
+		transfer(testAccount, "POOL", gobtc, 4),
+		transfer("POOL", testAccount, gobtc, 5),
+		transfer(testAccount, "DEFLEX", 0, 2),
+		transfer(testAccount, "ROUTER", usdc, 1000),
+	)
+	processed, err := ApplAggregatorSwap(filterGroup(t, txns, assetMap), txns, "Deflex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trades, fees, remainders int
+	for _, r := range processed {
+		switch {
+		case r.trade:
+			trades++
+			if r.recvASA != out || r.recvQty != 700 || r.sentASA != usdc || r.sentQty != 1000 {
+				t.Errorf("trade: got %+v", r)
+			}
+		case r.otherFee && !r.feeTx:
+			fees++
+			if r.sentASA != 0 || r.sentQty != 2 {
+				t.Errorf("fee: got %+v", r)
+			}
+		case r.IsDeposit():
+			remainders++
+			if r.recvASA != gobtc || r.recvQty != 1 {
+				t.Errorf("remainder: got %+v", r)
+			}
+		case !r.feeTx:
+			t.Errorf("unexpected record %+v", r)
+		}
+	}
+	if trades != 1 || fees != 1 || remainders != 1 {
+		t.Errorf("got %d trades, %d fees, %d remainders, want 1 of each", trades, fees, remainders)
+	}
+
+	// Two outputs can't be netted to a single trade, nor can a router call which is not a swap, e.g. an opt-in
+	// funding the router. Both are left for the unclassified report.
+	optin := applGroup(989365103, "", transfer(testAccount, "ROUTER", 0, 100000))
+	optin[0].ApplicationTransaction.OnCompletion = "optin"
+	for _, txns := range [][]models.Transaction{
+		applGroup(989365103, "swap", transfer("ROUTER", testAccount, out, 700), transfer("ROUTER", testAccount, gobtc, 5),
+			transfer(testAccount, "ROUTER", usdc, 1000)),
+		optin,
+	} {
+		records := filterGroup(t, txns, assetMap)
+		processed, err := ApplAggregatorSwap(records, txns, "Deflex")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(processed) != len(records) {
+			t.Errorf("got %d records, want %d", len(processed), len(records))
+		}
+		for _, r := range processed {
+			if r.trade || (!r.feeTx && r.unclassified == "") {
+				t.Errorf("got %+v, want an unclassified record", r)
+			}
+		}
+	}
+
+	// With an ALGO input, the smaller ALGO payment to the aggregator is a fee.
+	txns = applGroup(989365103, "swap", transfer("ROUTER", testAccount, out, 700), transfer(testAccount, "DEFLEX", 0, 2),
+		transfer(testAccount, "ROUTER", 0, 1000))
+	processed, err = ApplAggregatorSwap(filterGroup(t, txns, assetMap), txns, "Deflex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades, fees = 0, 0
+	for _, r := range processed {
+		switch {
+		case r.trade:
+			trades++
+			if r.recvASA != out || r.recvQty != 700 || r.sentASA != 0 || r.sentQty != 1000 {
+				t.Errorf("trade: got %+v", r)
+			}
+		case r.otherFee && !r.feeTx:
+			fees++
+			if r.sentASA != 0 || r.sentQty != 2 {
+				t.Errorf("fee: got %+v", r)
+			}
+		case !r.feeTx:
+			t.Errorf("unexpected record %+v", r)
+		}
+	}
+	if trades != 1 || fees != 1 {
+		t.Errorf("got %d trades, %d fees, want 1 of each", trades, fees)
+	}
+
+	// The aggregator is matched by any call in the group, even when the first application call is a pool.
+	txns = applGroup(1002541853, "swap", transfer("ROUTER", testAccount, out, 700), transfer(testAccount, "ROUTER", usdc, 1000))
+	txns = append(txns, models.Transaction{Id: "ROUTE", Type: "appl", Sender: testAccount, Group: []byte("group"),
+		ApplicationTransaction: models.TransactionApplication{ApplicationId: 989365103, OnCompletion: "noop"}})
+	handler, ok := findApplHandler(txns[0].ApplicationTransaction, txns)
+	if !ok || handler.name != "Deflex" {
+		t.Errorf("got handler %q, want Deflex", handler.name)
+	}
+}
+
+func TestTinymanV2FlashLoan(t *testing.T) {
+	const usdc = 31566704
+	assetMap := map[uint64]models.Asset{
+		usdc: {Index: usdc, Params: models.AssetParams{UnitName: "USDC", Decimals: 6}},
+	}
+	// The pool lends 1000 USDC, used for an arbitrage on another pool, and is repaid in two transfers with a fee of 3.
+	group := func(repays ...uint64) ([]ExportRecord, []models.Transaction) {
+		loan := transfer("POOL", testAccount, usdc, 1000)
+		txns := applGroup(1002541853, "flash_loan", transfer(testAccount, "OTHER", usdc, 1000), transfer("OTHER", testAccount, usdc, 1010))
+		txns[0].InnerTxns = []models.Transaction{loan}
+		for _, qty := range repays {
+			txns = append(txns, applGroup(0, "", transfer(testAccount, "POOL", usdc, qty))[1])
+		}
+		records, err := FilterTransaction(loan, "inner-CALL", testAccount, assetMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(records, filterGroup(t, txns, assetMap)...), txns
+	}
+
+	records, txns := group(600, 403)
+	processed, err := ApplTinymanV2(records, txns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaned, repaid, fees uint64
+	var unclassified int
+	for _, r := range processed {
+		switch {
+		case r.incomeNoTax:
+			loaned += r.recvQty
+		case r.expenseNoTax:
+			repaid += r.sentQty
+		case r.borrow:
+			fees += r.sentQty
+		case r.unclassified != "":
+			unclassified++
+		}
+	}
+	if loaned != 1000 || repaid != 1000 || fees != 3 || unclassified != 2 {
+		t.Errorf("got loaned %d, repaid %d, fees %d, %d unclassified, want 1000, 1000, 3 and 2", loaned, repaid, fees, unclassified)
+	}
+
+	// A loan which is not repaid in full leaves the group unclassified.
+	records, txns = group(900)
+	processed, err = ApplTinymanV2(records, txns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range processed {
+		if !r.feeTx && r.unclassified == "" {
+			t.Errorf("got %+v, want an unclassified record", r)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package exporter
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+// ApplState holds the persistent state of the application handlers for an account, keyed by handler name.
+type ApplState map[string]json.RawMessage
+
+// Get decodes the state saved for the named handler into v. v is left unchanged if there is no saved state.
+func (s ApplState) Get(name string, v interface{}) error {
+	data, ok := s[name]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s state: %w", name, err)
+	}
+	return nil
+}
+
+// Set saves v as the state of the named handler.
+func (s ApplState) Set(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s state: %w", name, err)
+	}
+	s[name] = data
+	return nil
+}
+
+type applProcessFunc func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error)
+
+// applHandler exports the transaction groups of the applications it matches.
+type applHandler struct {
+	name  string
+	match func(appID uint64) bool
+	// matchCall matches the application call of a group, for applications deployed once per pool, e.g. Pact.
+	matchCall func(appl models.TransactionApplication) bool
+	// matchGroup matches a group calling the application in any of its transactions, including inner transactions.
+	// It takes precedence over the other handlers, e.g. for an aggregator whose route also calls pools with a handler.
+	matchGroup func(txns []models.Transaction) bool
+
+	// deferred handlers are processed after all the account transactions are fetched, oldest group first.
+	deferred bool
+	// persistent handlers receive the account ApplState, which is saved between runs.
+	persistent bool
+
+	process applProcessFunc
+}
+
+var applHandlers []applHandler
+
+func registerApplication(handler applHandler) {
+	applHandlers = append(applHandlers, handler)
+}
+
+// groupCalls matches a group calling any of the given application IDs.
+func groupCalls(ids ...uint64) func([]models.Transaction) bool {
+	return func(txns []models.Transaction) bool {
+		for _, id := range ids {
+			if callsApplication(txns, id) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// callsApplication reports whether any transaction of txns, inner transactions included, calls appID.
+func callsApplication(txns []models.Transaction, appID uint64) bool {
+	for _, tx := range txns {
+		if tx.Type == "appl" && tx.ApplicationTransaction.ApplicationId == appID {
+			return true
+		}
+		if callsApplication(tx.InnerTxns, appID) {
+			return true
+		}
+	}
+	return false
+}
+
+// abiSelectors returns the ABI method selectors of the method signatures, the first 4 bytes of their SHA-512/256 hash,
+// mapped to their signature.
+// https://arc.algorand.foundation/ARCs/arc-0004
+func abiSelectors(signatures ...string) map[string]string {
+	selectors := map[string]string{}
+	for _, signature := range signatures {
+		hash := sha512.Sum512_256([]byte(signature))
+		selectors[string(hash[:4])] = signature
+	}
+	return selectors
+}
+
+// appIDs matches any of the given application IDs.
+func appIDs(ids ...uint64) func(uint64) bool {
+	return func(appID uint64) bool {
+		for _, id := range ids {
+			if id == appID {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// findApplHandler returns the handler of the group txns, whose first application call is appl.
+func findApplHandler(appl models.TransactionApplication, txns []models.Transaction) (applHandler, bool) {
+	for _, handler := range applHandlers {
+		if handler.matchGroup != nil && handler.matchGroup(txns) {
+			return handler, true
+		}
+	}
+	for _, handler := range applHandlers {
+		if handler.match != nil && handler.match(appl.ApplicationId) {
+			return handler, true
+		}
+	}
+	for _, handler := range applHandlers {
+		if handler.matchCall != nil && handler.matchCall(appl) {
+			return handler, true
+		}
+	}
+	return applHandler{}, false
+}
+
+// IsApplGroup returns true if txns is a group transaction, which is how applications (e.g. DeFi, Liquidity Pool) are usually called.
+func IsApplGroup(txns []models.Transaction) bool {
+	return len(txns) > 1 && len(txns[0].Group) > 0
+}
+
+// normalizeApplication exports a group transaction with the registered application handler.
+// handled is false when no handler is registered for the application.
+func normalizeApplication(log *Logger, records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) (processed []ExportRecord, handled bool, deferred bool, err error) {
+	log = log.With("group", base64.StdEncoding.EncodeToString(txns[0].Group))
+	appl, err := ExtractApplication(txns)
+	if err != nil {
+		log.Warn("unable to find application", "error", err)
+	}
+	log = log.With("app", appl.ApplicationId)
+
+	handler, ok := findApplHandler(appl, txns)
+	if !ok {
+		log.Debug("no handler for application")
+		return records, false, false, nil
+	}
+	log = log.With("handler", handler.name)
+	if handler.deferred {
+		log.Debug("deferring application group")
+		return records, true, true, nil
+	}
+	log.Debug("processing application group")
+	if !handler.persistent {
+		state = nil
+	}
+	processed, err = handler.process(records, txns, assetMap, state)
+	return processed, true, false, applGroupError(handler, appl, txns, err)
+}
+
+// applGroupError adds the handler, application and group to an error of the handler, which the caller logs.
+func applGroupError(handler applHandler, appl models.TransactionApplication, txns []models.Transaction, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s handler, application ID %d, group %s: %w", handler.name, appl.ApplicationId, base64.StdEncoding.EncodeToString(txns[0].Group), err)
+}
+
+// NormalizeDeferred exports a group transaction that was deferred by NormalizeRecords.
+// Deferred groups must be processed oldest first, state is updated for persistent handlers.
+func NormalizeDeferred(log *Logger, records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+	appl, err := ExtractApplication(txns)
+	if err != nil {
+		return records, err
+	}
+	handler, ok := findApplHandler(appl, txns)
+	if !ok || !handler.deferred {
+		return records, fmt.Errorf("no deferred handler for application ID %d", appl.ApplicationId)
+	}
+	log = log.With("group", base64.StdEncoding.EncodeToString(txns[0].Group), "app", appl.ApplicationId, "handler", handler.name)
+	log.Debug("processing deferred application group")
+	if !handler.persistent {
+		state = nil
+	}
+	processed, err := handler.process(records, txns, assetMap, state)
+	return processed, applGroupError(handler, appl, txns, err)
+}
@@ -0,0 +1,43 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func init() {
+	// Deflex order router, swaps are routed through the pools of several AMMs.
+	// The group is matched when any transaction calls the router, the first application call can be a pool.
+	// https://docs.deflex.fi/
+	registerApplication(applHandler{
+		name:       "Deflex",
+		matchGroup: groupCalls(989365103),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplAggregatorSwap(records, txns, "Deflex")
+		},
+	})
+
+	// Vestige aggregator.
+	// https://vestige.fi/
+	registerApplication(applHandler{
+		name:       "Vestige",
+		matchGroup: groupCalls(1026089225),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplAggregatorSwap(records, txns, "Vestige")
+		},
+	})
+}
+
+// ApplAggregatorSwap exports a swap of a DEX aggregator as a single trade of the account's input asset for its
+// output asset, however many pools it was routed through.
+// Any other group calling the aggregator (e.g. an opt-in or a swap with several outputs) is left as it is and
+// listed in the unclassified report.
+func ApplAggregatorSwap(records []ExportRecord, txns []models.Transaction, aggregator string) ([]ExportRecord, error) {
+	if processed, ok := ammAggregatedSwap(records, splitApplRecords(records), aggregator+" Swap"); ok {
+		return processed, nil
+	}
+	onCompletion, action := ExtractFirstArg(txns)
+	reason := fmt.Sprintf("%s group is not a swap of one asset for another | onCompletion: %s | action: %s", aggregator, onCompletion, action)
+	return unclassifiedRecords(records, reason), nil
+}
@@ -2,8 +2,20 @@ package exporter
 
 import (
 	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
 )
 
+func init() {
+	registerApplication(applHandler{
+		name:  "Akita Token Swap",
+		match: appIDs(537279393),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplAkitaTokenSwap(records)
+		},
+	})
+}
+
 // ApplAkitaTokenSwap exports Akita Token Swap.
 // AKITA -> AKTA swap
 // https://swap.akita.community/
@@ -6,208 +6,282 @@ import (
 	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
 )
 
-// https://docs.algofi.org/protocol/mainnet-contracts
-// https://cointracking.freshdesk.com/en/support/solutions/articles/29000033408-loans-and-their-repayments
-type AlgoFiState struct {
-	SupplyALGO  uint64
-	SupplySTBL  uint64
-	SupplyUSDC  uint64
-	SupplygoBTC uint64
-	SupplygoETH uint64
-
-	BorrowALGO  uint64
-	BorrowSTBL  uint64
-	BorrowUSDC  uint64
-	BorrowgoBTC uint64
-	BorrowgoETH uint64
+// AlgoFiStateName is the ApplState name of the AlgoFi lending state.
+const AlgoFiStateName = "AlgoFi"
+
+// algoFiManagerAppID is the AlgoFi lending manager, which every market call of the v1 markets goes through.
+const algoFiManagerAppID = 465818260
+
+func init() {
+	// AlgoFi markets need the supplied and borrowed amounts from all previous transactions to split out interest.
+	// Markets without an ID here (e.g. vALGO, goMINT and USDt) are matched by their call of the manager.
+	// https://app.algofi.org/
+	registerApplication(applHandler{
+		name: "AlgoFi Lending",
+		match: appIDs(
+			465814065, // ALGO
+			465814103, // USDC
+			465814149, // goBTC
+			465814222, // goETH
+			465814278, // STBL
+		),
+		matchGroup: func(txns []models.Transaction) bool {
+			_, err := algoFiMarketCall(txns)
+			return err == nil && callsApplication(txns, algoFiManagerAppID)
+		},
+		deferred:   true,
+		persistent: true,
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			var algoFiState LendingState
+			if err := state.Get(AlgoFiStateName, &algoFiState); err != nil {
+				return records, err
+			}
+			processed, algoFiState, err := ApplAlgoFiLend(records, txns, assetMap, algoFiState)
+			if err != nil {
+				return processed, err
+			}
+			return processed, state.Set(AlgoFiStateName, algoFiState)
+		},
+	})
+
+	// AlgoFi v2 lending markets share the AlgoFi state, keyed by market.
+	// The market call is usually preceded by calls of the manager and the oracles, so any call of a market matches.
+	// https://docs.algofi.org/algofi-lending-v2/
+	registerApplication(applHandler{
+		name:       "AlgoFi Lending v2",
+		matchGroup: groupCalls(algoFiV2Markets...),
+		deferred:   true,
+		persistent: true,
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			var algoFiState LendingState
+			if err := state.Get(AlgoFiStateName, &algoFiState); err != nil {
+				return records, err
+			}
+			processed, algoFiState, err := ApplAlgoFiLendV2(records, txns, algoFiState)
+			if err != nil {
+				return processed, err
+			}
+			return processed, state.Set(AlgoFiStateName, algoFiState)
+		},
+	})
+
+	// AlgoFi Staking
+	// https://app.algofi.org/staking
+	registerApplication(applHandler{
+		name: "AlgoFi Staking",
+		match: appIDs(
+			482608345, // STBL -> STBL
+			553869413, // STBL-USDC-LP-V2 -> ALGO/STBL
+		),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplAlgoFiStaking(records, txns)
+		},
+	})
 }
 
-// https://app.algofi.org/
-func ApplAlgoFiLend(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state AlgoFiState) ([]ExportRecord, AlgoFiState, error) {
-	onCompletion, action := ExtractFirstArg(txns)
+// algoFiV2Markets are the application IDs of the AlgoFi v2 lending markets.
+var algoFiV2Markets = []uint64{
+	818179346, // ALGO
+	818182048, // USDC
+	818188553, // goBTC
+	818190205, // goETH
+}
 
-	var processed []ExportRecord
+// algoFiLegacyMarkets are the markets of the fields of the AlgoFi state saved before it was keyed by market.
+var algoFiLegacyMarkets = []struct {
+	supply  string
+	borrow  string
+	appID   uint64
+	assetID uint64
+}{
+	{"SupplyALGO", "BorrowALGO", 465814065, 0},
+	{"SupplyUSDC", "BorrowUSDC", 465814103, 31566704},
+	{"SupplygoBTC", "BorrowgoBTC", 465814149, 386192725},
+	{"SupplygoETH", "BorrowgoETH", 465814222, 386195940},
+	{"SupplySTBL", "BorrowSTBL", 465814278, 465865291},
+}
 
-	// Supply
-	if action == "mt" {
-		r := records[0]
-		processed = append(processed, records...)
-		processed[0].comment = "AlgoFi - Supply"
-		switch asaUnitName(r.sentASA, assetMap) {
-		case "ALGO":
-			state.SupplyALGO = state.SupplyALGO + r.sentQty - r.fee
-		case "STBL":
-			state.SupplySTBL = state.SupplySTBL + r.sentQty
-		case "USDC":
-			state.SupplyUSDC = state.SupplyUSDC + r.sentQty
-		case "goBTC":
-			state.SupplygoBTC = state.SupplygoBTC + r.sentQty
-		case "goETH":
-			state.SupplygoETH = state.SupplygoETH + r.sentQty
-		default:
-			return records, state, fmt.Errorf("invalid ApplAlgoFiMarket() Supply record | onCompletion: %s | action: %s | records length: %d | txns length: %d\n", onCompletion, action, len(records), len(txns))
+// MigrateAlgoFiState converts the AlgoFi state saved with a fixed field per asset, e.g. SupplyALGO and BorrowALGO,
+// to the state keyed by market.
+func MigrateAlgoFiState(state ApplState) error {
+	if _, ok := state[AlgoFiStateName]; !ok {
+		return nil
+	}
+	var legacy map[string]uint64
+	if err := state.Get(AlgoFiStateName, &legacy); err != nil {
+		return err
+	}
+	var algoFiState LendingState
+	for _, m := range algoFiLegacyMarkets {
+		if legacy[m.supply] == 0 && legacy[m.borrow] == 0 {
+			continue
 		}
-		return processed, state, nil
+		market := algoFiState.market(m.appID, m.assetID)
+		market.Supply = legacy[m.supply]
+		market.Borrow = legacy[m.borrow]
 	}
+	return state.Set(AlgoFiStateName, algoFiState)
+}
 
-	// Withdraw
-	if action == "rcu" {
-		r := records[0]
-		processed = append(processed, records...)
-		processed[0].comment = "AlgoFi - Withdraw"
-		switch asaUnitName(r.recvASA, assetMap) {
-		case "ALGO":
-			if r.recvQty > state.SupplyALGO {
-				processed[0].recvQty = state.SupplyALGO
-				r.recvQty = r.recvQty - state.SupplyALGO
-				r.lending = true
-				r.comment = "AlgoFi - Withdraw - Lending Income"
-				processed = append(processed, r)
-				state.SupplyALGO = 0
-			} else {
-				state.SupplyALGO = state.SupplyALGO - r.recvQty
-			}
-		case "STBL":
-			if r.recvQty > state.SupplySTBL {
-				processed[0].recvQty = state.SupplySTBL
-				r.recvQty = r.recvQty - state.SupplySTBL
-				r.lending = true
-				r.comment = "AlgoFi - Withdraw - Lending Income"
-				processed = append(processed, r)
-				state.SupplySTBL = 0
-			} else {
-				state.SupplySTBL = state.SupplySTBL - r.recvQty
-			}
-		case "USDC":
-			if r.recvQty > state.SupplyUSDC {
-				processed[0].recvQty = state.SupplyUSDC
-				r.recvQty = r.recvQty - state.SupplyUSDC
-				r.lending = true
-				r.comment = "AlgoFi - Withdraw - Lending Income"
-				processed = append(processed, r)
-				state.SupplyUSDC = 0
-			} else {
-				state.SupplyUSDC = state.SupplyUSDC - r.recvQty
-			}
-		case "goBTC":
-			if r.recvQty > state.SupplygoBTC {
-				processed[0].recvQty = state.SupplygoBTC
-				r.recvQty = r.recvQty - state.SupplygoBTC
-				r.lending = true
-				r.comment = "AlgoFi - Withdraw - Lending Income"
-				processed = append(processed, r)
-				state.SupplygoBTC = 0
-			} else {
-				state.SupplygoBTC = state.SupplygoBTC - r.recvQty
-			}
-		case "goETH":
-			if r.recvQty > state.SupplygoETH {
-				processed[0].recvQty = state.SupplygoETH
-				r.recvQty = r.recvQty - state.SupplygoETH
-				r.lending = true
-				r.comment = "AlgoFi - Withdraw - Lending Income"
-				processed = append(processed, r)
-				state.SupplygoETH = 0
-			} else {
-				state.SupplygoETH = state.SupplygoETH - r.recvQty
-			}
-		default:
-			return records, state, fmt.Errorf("invalid ApplAlgoFiMarket() Withdraw record | onCompletion: %s | action: %s | records length: %d | txns length: %d\n", onCompletion, action, len(records), len(txns))
+// algoFiMarketCall returns the market call of an AlgoFi v1 lending group, the first application call with a
+// market action other than the call of the manager.
+func algoFiMarketCall(txns []models.Transaction) (models.TransactionApplication, error) {
+	for _, tx := range txns {
+		appl := tx.ApplicationTransaction
+		if tx.Type != "appl" || appl.ApplicationId == algoFiManagerAppID || len(appl.ApplicationArgs) == 0 {
+			continue
+		}
+		switch string(appl.ApplicationArgs[0]) {
+		case "mt", "rcu", "b", "rb":
+			return appl, nil
 		}
-		return processed, state, nil
 	}
+	return models.TransactionApplication{}, fmt.Errorf("AlgoFi market call not found")
+}
 
+// https://app.algofi.org/
+// https://docs.algofi.org/protocol/mainnet-contracts
+func ApplAlgoFiLend(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state LendingState) ([]ExportRecord, LendingState, error) {
+	onCompletion, action := ExtractFirstArg(txns)
+	appl, err := algoFiMarketCall(txns)
+	if err != nil {
+		return records, state, fmt.Errorf("invalid ApplAlgoFiLend() record | onCompletion: %s | action: %s | records length: %d | txns length: %d: %w", onCompletion, action, len(records), len(txns), err)
+	}
+	action = string(appl.ApplicationArgs[0])
+
+	processed := append([]ExportRecord{}, records...)
+	var extra *ExportRecord
+	switch action {
+	// Supply
+	case "mt":
+		processed[0].comment = "AlgoFi - Supply"
+		state.supply(appl.ApplicationId, processed[0])
+	// Withdraw
+	case "rcu":
+		processed[0], extra = state.redeem(appl.ApplicationId, processed[0], "AlgoFi")
+		processed[0].comment = "AlgoFi - Withdraw"
 	// Borrow
-	if action == "b" {
-		r := records[0]
-		processed = append(processed, records...)
+	case "b":
 		processed[0].incomeNoTax = true
 		processed[0].comment = "AlgoFi - Borrow"
-		switch asaUnitName(r.recvASA, assetMap) {
-		case "ALGO":
-			state.BorrowALGO = state.BorrowALGO + r.recvQty
-		case "STBL":
-			state.BorrowSTBL = state.BorrowSTBL + r.recvQty
-		case "USDC":
-			state.BorrowUSDC = state.BorrowUSDC + r.recvQty
-		case "goBTC":
-			state.BorrowgoBTC = state.BorrowgoBTC + r.recvQty
-		case "goETH":
-			state.BorrowgoETH = state.BorrowgoETH + r.recvQty
-		default:
-			return records, state, fmt.Errorf("invalid ApplAlgoFiMarket() Borrow record | onCompletion: %s | action: %s | records length: %d | txns length: %d\n", onCompletion, action, len(records), len(txns))
+		state.borrow(appl.ApplicationId, processed[0])
+	// Repay
+	case "rb":
+		processed[0], extra = state.repay(appl.ApplicationId, processed[0], "AlgoFi")
+		processed[0].expenseNoTax = true
+		processed[0].comment = "AlgoFi - Repay"
+	default:
+		return records, state, fmt.Errorf("invalid ApplAlgoFiLend() record | onCompletion: %s | action: %s | records length: %d | txns length: %d\n", onCompletion, action, len(records), len(txns))
+	}
+	if extra != nil {
+		processed = append(processed, *extra)
+	}
+	return processed, state, nil
+}
+
+// ApplAlgoFiLendV2 exports AlgoFi v2 lending market transactions.
+// Supplying either mints a bAsset, a receipt for the supplied amount, or adds the amount as collateral.
+// A bAsset can itself be added to and removed from the collateral.
+// The bAssets are exported as non taxable, the same as borrowed amounts.
+// https://docs.algofi.org/algofi-lending-v2/
+func ApplAlgoFiLendV2(records []ExportRecord, txns []models.Transaction, state LendingState) ([]ExportRecord, LendingState, error) {
+	// The action is the first argument of the market call, not of the manager or oracle calls before it.
+	var appl models.TransactionApplication
+	for _, tx := range txns {
+		if tx.Type == "appl" && appIDs(algoFiV2Markets...)(tx.ApplicationTransaction.ApplicationId) {
+			appl = tx.ApplicationTransaction
+			break
 		}
-		return processed, state, nil
 	}
+	if appl.ApplicationId == 0 {
+		return records, state, fmt.Errorf("invalid ApplAlgoFiLendV2() record | no market call | records length: %d | txns length: %d", len(records), len(txns))
+	}
+	onCompletion, action := appl.OnCompletion, ""
+	if len(appl.ApplicationArgs) > 0 {
+		action = string(appl.ApplicationArgs[0])
+	}
+	split := splitApplRecords(records)
 
+	processed := append([]ExportRecord{}, records...)
+	var extra *ExportRecord
+	switch {
+	// Supply, minting a bAsset.
+	case action == "mb" && len(split.withdrawals) == 1 && len(split.deposits) == 1:
+		state.supply(appl.ApplicationId, processed[split.withdrawals[0]])
+		processed[split.withdrawals[0]].comment = "AlgoFi v2 - Supply"
+		processed[split.deposits[0]].incomeNoTax = true
+		processed[split.deposits[0]].comment = "AlgoFi v2 - Supply - bAsset"
+	// Supply as collateral.
+	case action == "auc" && len(split.withdrawals) == 1 && len(split.deposits) == 0:
+		state.supply(appl.ApplicationId, processed[split.withdrawals[0]])
+		processed[split.withdrawals[0]].comment = "AlgoFi v2 - Supply"
+	// Redeem, burning a bAsset.
+	case action == "bb" && len(split.withdrawals) == 1 && len(split.deposits) == 1:
+		i := split.deposits[0]
+		processed[i], extra = state.redeem(appl.ApplicationId, processed[i], "AlgoFi v2")
+		processed[i].comment = "AlgoFi v2 - Withdraw"
+		processed[split.withdrawals[0]].expenseNoTax = true
+		processed[split.withdrawals[0]].comment = "AlgoFi v2 - Withdraw - bAsset"
+	// Redeem collateral.
+	case action == "ruc" && len(split.withdrawals) == 0 && len(split.deposits) == 1:
+		i := split.deposits[0]
+		processed[i], extra = state.redeem(appl.ApplicationId, processed[i], "AlgoFi v2")
+		processed[i].comment = "AlgoFi v2 - Withdraw"
+	// Add bAsset collateral, the bAsset is moved to the collateral of the account and its supply is unchanged.
+	case action == "abc" && len(split.withdrawals) == 1 && len(split.deposits) == 0:
+		processed[split.withdrawals[0]].expenseNoTax = true
+		processed[split.withdrawals[0]].comment = "AlgoFi v2 - Add Collateral - bAsset"
+	// Remove bAsset collateral.
+	case action == "rbc" && len(split.withdrawals) == 0 && len(split.deposits) == 1:
+		processed[split.deposits[0]].incomeNoTax = true
+		processed[split.deposits[0]].comment = "AlgoFi v2 - Remove Collateral - bAsset"
+	// Borrow
+	case action == "b" && len(split.withdrawals) == 0 && len(split.deposits) == 1:
+		i := split.deposits[0]
+		state.borrow(appl.ApplicationId, processed[i])
+		processed[i].incomeNoTax = true
+		processed[i].comment = "AlgoFi v2 - Borrow"
 	// Repay
-	if action == "rb" {
-		r := records[0]
-		processed = append(processed, records...)
-		processed[0].expenseNoTax = true
-		processed[0].comment = "AlgoFi - Repay"
-		switch asaUnitName(r.sentASA, assetMap) {
-		case "ALGO":
-			if (r.sentQty - r.fee) > state.BorrowALGO {
-				processed[0].sentQty = state.BorrowALGO + r.fee
-				r.sentQty = (r.sentQty - r.fee) - state.BorrowALGO
-				r.fee = 0
-				r.borrow = true
-				r.comment = "AlgoFi - Repay - Borrowing Fee"
-				processed = append(processed, r)
-				state.BorrowALGO = 0
-			} else {
-				state.BorrowALGO = state.BorrowALGO - (r.sentQty - r.fee)
-			}
-		case "STBL":
-			if r.sentQty > state.BorrowSTBL {
-				processed[0].sentQty = state.BorrowSTBL
-				r.sentQty = r.sentQty - state.BorrowSTBL
-				r.borrow = true
-				r.comment = "AlgoFi - Repay - Borrowing Fee"
-				processed = append(processed, r)
-				state.BorrowSTBL = 0
-			} else {
-				state.BorrowSTBL = state.BorrowSTBL - r.sentQty
-			}
-		case "USDC":
-			if r.sentQty > state.BorrowUSDC {
-				processed[0].sentQty = state.BorrowUSDC
-				r.sentQty = r.sentQty - state.BorrowUSDC
-				r.borrow = true
-				r.comment = "AlgoFi - Repay - Borrowing Fee"
-				processed = append(processed, r)
-				state.BorrowUSDC = 0
-			} else {
-				state.BorrowUSDC = state.BorrowUSDC - r.sentQty
-			}
-		case "goBTC":
-			if r.sentQty > state.BorrowgoBTC {
-				processed[0].sentQty = state.BorrowgoBTC
-				r.sentQty = r.sentQty - state.BorrowgoBTC
-				r.borrow = true
-				r.comment = "AlgoFi - Repay - Borrowing Fee"
-				processed = append(processed, r)
-				state.BorrowgoBTC = 0
-			} else {
-				state.BorrowgoBTC = state.BorrowgoBTC - r.sentQty
-			}
-		case "goETH":
-			if r.sentQty > state.BorrowgoETH {
-				processed[0].sentQty = state.BorrowgoETH
-				r.sentQty = r.sentQty - state.BorrowgoETH
-				r.borrow = true
-				r.comment = "AlgoFi - Repay - Borrowing Fee"
-				processed = append(processed, r)
-				state.BorrowgoETH = 0
-			} else {
-				state.BorrowgoETH = state.BorrowgoETH - r.sentQty
-			}
-		default:
-			return records, state, fmt.Errorf("invalid ApplAlgoFiMarket() Repay record | onCompletion: %s | action: %s | records length: %d | txns length: %d\n", onCompletion, action, len(records), len(txns))
+	case action == "rb" && len(split.withdrawals) == 1 && len(split.deposits) == 0:
+		i := split.withdrawals[0]
+		processed[i], extra = state.repay(appl.ApplicationId, processed[i], "AlgoFi v2")
+		processed[i].expenseNoTax = true
+		processed[i].comment = "AlgoFi v2 - Repay"
+	default:
+		return records, state, fmt.Errorf("invalid ApplAlgoFiLendV2() record | onCompletion: %s | action: %s | records length: %d | txns length: %d", onCompletion, action, len(records), len(txns))
+	}
+	if extra != nil {
+		processed = append(processed, *extra)
+	}
+	return processed, state, nil
+}
+
+// ApplAlgoFiStaking exports AlgoFi staking contract transactions, claimed rewards are staking income.
+// https://app.algofi.org/staking
+func ApplAlgoFiStaking(records []ExportRecord, txns []models.Transaction) ([]ExportRecord, error) {
+	onCompletion, action := ExtractFirstArg(txns)
+	split := splitApplRecords(records)
+
+	switch {
+	// Stake
+	case action == "mt" && len(split.withdrawals) == 1 && len(split.deposits) == 0:
+		records[split.withdrawals[0]].comment = "AlgoFi - Stake"
+		return records, nil
+	// Unstake
+	case action == "rcu" && len(split.withdrawals) == 0 && len(split.deposits) == 1:
+		records[split.deposits[0]].comment = "AlgoFi - Unstake"
+		return records, nil
+	// Claim
+	case action == "cr" && len(split.withdrawals) == 0 && len(split.deposits) > 0:
+		for _, i := range split.deposits {
+			records[i].staking = true
+			records[i].comment = "AlgoFi - Staking Rewards"
 		}
-		return processed, state, nil
+		return records, nil
+	// Opt-in and opt-out of the staking contract, only fees are exported.
+	case (onCompletion == "optin" || onCompletion == "closeout") && action == "" && len(split.withdrawals) == 0 && len(split.deposits) == 0:
+		return records, nil
 	}
 
-	return records, state, fmt.Errorf("invalid ApplAlgoFiMarket() record | onCompletion: %s | action: %s | records length: %d | txns length: %d\n", onCompletion, action, len(records), len(txns))
+	return records, fmt.Errorf("invalid ApplAlgoFiStaking() record | onCompletion: %s | action: %s | records length: %d | txns length: %d", onCompletion, action, len(records), len(txns))
 }
@@ -0,0 +1,251 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func TestAlgoFiLendNewMarket(t *testing.T) {
+	// A market and asset which have no fixed state field.
+	const appID, assetID = 123456, 789
+	assetMap := map[uint64]models.Asset{
+		assetID: {Index: assetID, Params: models.AssetParams{UnitName: "NEW", Decimals: 6}},
+	}
+	group := func(action string, tx models.Transaction) []models.Transaction {
+		tx.Type = "axfer"
+		return []models.Transaction{
+			// Newest first.
+			{Id: "CALL", Type: "appl", Sender: testAccount, Fee: 1000,
+				ApplicationTransaction: models.TransactionApplication{ApplicationId: appID, OnCompletion: "noop", ApplicationArgs: [][]byte{[]byte(action)}}},
+			tx,
+		}
+	}
+	apply := func(state LendingState, txns []models.Transaction) ([]ExportRecord, LendingState) {
+		var records []ExportRecord
+		for i := len(txns) - 1; i >= 0; i-- {
+			filtered, err := FilterTransaction(txns[i], "", testAccount, assetMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range filtered {
+				if !r.feeTx {
+					records = append(records, r)
+				}
+			}
+		}
+		processed, state, err := ApplAlgoFiLend(records, txns, assetMap, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return processed, state
+	}
+
+	var state LendingState
+	_, state = apply(state, group("mt", models.Transaction{Sender: testAccount,
+		AssetTransferTransaction: models.TransactionAssetTransfer{AssetId: assetID, Amount: 1000, Receiver: "MARKET"}}))
+	_, state = apply(state, group("b", models.Transaction{Sender: "MARKET",
+		AssetTransferTransaction: models.TransactionAssetTransfer{AssetId: assetID, Amount: 400, Receiver: testAccount}}))
+	market := state.Markets[lendingMarketKey(appID, assetID)]
+	if market == nil || market.Supply != 1000 || market.Borrow != 400 {
+		t.Fatalf("got %+v", market)
+	}
+
+	records, state := apply(state, group("rb", models.Transaction{Sender: testAccount,
+		AssetTransferTransaction: models.TransactionAssetTransfer{AssetId: assetID, Amount: 450, Receiver: "MARKET"}}))
+	if len(records) != 2 || records[0].sentQty != 400 || records[1].sentQty != 50 || !records[1].borrow {
+		t.Errorf("repay: got %+v", records)
+	}
+	records, state = apply(state, group("rcu", models.Transaction{Sender: "MARKET",
+		AssetTransferTransaction: models.TransactionAssetTransfer{AssetId: assetID, Amount: 1100, Receiver: testAccount}}))
+	if len(records) != 2 || records[0].recvQty != 1000 || records[1].recvQty != 100 || !records[1].lending {
+		t.Errorf("withdraw: got %+v", records)
+	}
+	if market.Supply != 0 || market.Borrow != 0 {
+		t.Errorf("got %+v, want an empty market", market)
+	}
+}
+
+// applGroup is an application call of appID with action, followed by the transfers of txns (asset transfers by default), newest first.
+func applGroup(appID uint64, action string, txns ...models.Transaction) []models.Transaction {
+	group := []models.Transaction{{Id: "CALL", Type: "appl", Sender: testAccount, Fee: 1000, Group: []byte("group"),
+		ApplicationTransaction: models.TransactionApplication{ApplicationId: appID, OnCompletion: "noop", ApplicationArgs: [][]byte{[]byte(action)}}}}
+	for _, tx := range txns {
+		if tx.Type == "" {
+			tx.Type = "axfer"
+		}
+		tx.Group = []byte("group")
+		group = append(group, tx)
+	}
+	return group
+}
+
+// transfer is a payment of amount from sender to receiver, an asset transfer unless assetID is ALGO.
+func transfer(sender, receiver string, assetID, amount uint64) models.Transaction {
+	if assetID == 0 {
+		return models.Transaction{Type: "pay", Sender: sender,
+			PaymentTransaction: models.TransactionPayment{Amount: amount, Receiver: receiver}}
+	}
+	return models.Transaction{Type: "axfer", Sender: sender,
+		AssetTransferTransaction: models.TransactionAssetTransfer{AssetId: assetID, Amount: amount, Receiver: receiver}}
+}
+
+func filterGroup(t *testing.T, txns []models.Transaction, assetMap map[uint64]models.Asset) []ExportRecord {
+	var records []ExportRecord
+	for _, tx := range txns {
+		filtered, err := FilterTransaction(tx, "", testAccount, assetMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, filtered...)
+	}
+	return records
+}
+
+func TestAlgoFiLendManager(t *testing.T) {
+	// A market with no ID in the handler, e.g. goMINT, is matched by the call of the manager.
+	const appID, gomint = 123456, 441139422
+	assetMap := map[uint64]models.Asset{
+		gomint: {Index: gomint, Params: models.AssetParams{UnitName: "goMINT", Decimals: 6}},
+	}
+	// Newest first: the manager call, then the market call and the supplied goMINT.
+	txns := append([]models.Transaction{{Id: "MANAGER", Type: "appl", Sender: testAccount, Fee: 1000, Group: []byte("group"),
+		ApplicationTransaction: models.TransactionApplication{ApplicationId: algoFiManagerAppID, OnCompletion: "noop", ApplicationArgs: [][]byte{[]byte("mt")}}}},
+		applGroup(appID, "mt", transfer(testAccount, "MARKET", gomint, 1000))...)
+	handler, ok := findApplHandler(txns[0].ApplicationTransaction, txns)
+	if !ok || handler.name != "AlgoFi Lending" {
+		t.Fatalf("got handler %q, want AlgoFi Lending", handler.name)
+	}
+	// The market handler is given the transfers of the group, as in TestAlgoFiLendNewMarket.
+	var records []ExportRecord
+	for _, r := range filterGroup(t, txns, assetMap) {
+		if !r.feeTx {
+			records = append(records, r)
+		}
+	}
+	state := ApplState{}
+	if _, err := handler.process(records, txns, assetMap, state); err != nil {
+		t.Fatal(err)
+	}
+	var algoFiState LendingState
+	if err := state.Get(AlgoFiStateName, &algoFiState); err != nil {
+		t.Fatal(err)
+	}
+	if market := algoFiState.Markets[lendingMarketKey(appID, gomint)]; market == nil || market.Supply != 1000 {
+		t.Errorf("got %+v, want a supply of 1000", market)
+	}
+}
+
+func TestAlgoFiLendV2(t *testing.T) {
+	const appID, assetID, bAssetID = 818182048, 31566704, 818182311
+	assetMap := map[uint64]models.Asset{
+		assetID:  {Index: assetID, Params: models.AssetParams{UnitName: "USDC", Decimals: 6}},
+		bAssetID: {Index: bAssetID, Params: models.AssetParams{UnitName: "bUSDC", Decimals: 6}},
+	}
+	var state LendingState
+	mint := applGroup(appID, "mb", transfer("MARKET", testAccount, bAssetID, 900), transfer(testAccount, "MARKET", assetID, 1000))
+	records, state, err := ApplAlgoFiLendV2(filterGroup(t, mint, assetMap), mint, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r.recvASA == bAssetID && !r.incomeNoTax {
+			t.Errorf("bAsset deposit is taxable: %+v", r)
+		}
+	}
+
+	burn := applGroup(appID, "bb", transfer("MARKET", testAccount, assetID, 1100), transfer(testAccount, "MARKET", bAssetID, 900))
+	records, state, err = ApplAlgoFiLendV2(filterGroup(t, burn, assetMap), burn, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var withdrawn, interest uint64
+	for _, r := range records {
+		switch {
+		case r.recvASA == assetID && r.lending:
+			interest += r.recvQty
+		case r.recvASA == assetID:
+			withdrawn += r.recvQty
+		}
+	}
+	if withdrawn != 1000 || interest != 100 {
+		t.Errorf("got withdrawn %d, interest %d, want 1000 and 100", withdrawn, interest)
+	}
+	if market := state.Markets[lendingMarketKey(appID, assetID)]; market.Supply != 0 {
+		t.Errorf("got %+v, want an empty market", market)
+	}
+
+	if _, _, err := ApplAlgoFiLendV2(filterGroup(t, burn, assetMap), applGroup(appID, "unknown"), state); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+
+	// The market call follows the manager call, whose action is not the market's.
+	withManager := func(txns []models.Transaction) []models.Transaction {
+		manager := applGroup(1, "update_prices")[0]
+		manager.Id = "MANAGER"
+		return append([]models.Transaction{manager}, txns...)
+	}
+	for _, test := range []struct {
+		action string
+		txns   []models.Transaction
+		check  func(r ExportRecord) bool
+	}{
+		{"abc", withManager(applGroup(appID, "abc", transfer(testAccount, "MARKET", bAssetID, 900))), func(r ExportRecord) bool { return r.expenseNoTax }},
+		{"rbc", withManager(applGroup(appID, "rbc", transfer("MARKET", testAccount, bAssetID, 900))), func(r ExportRecord) bool { return r.incomeNoTax }},
+	} {
+		handler, ok := findApplHandler(test.txns[0].ApplicationTransaction, test.txns)
+		if !ok || handler.name != "AlgoFi Lending v2" {
+			t.Fatalf("%s: got handler %q, want AlgoFi Lending v2", test.action, handler.name)
+		}
+		records, _, err := ApplAlgoFiLendV2(filterGroup(t, test.txns, assetMap), test.txns, LendingState{})
+		if err != nil {
+			t.Fatalf("%s: %v", test.action, err)
+		}
+		for _, r := range records {
+			if !r.feeTx && !test.check(r) {
+				t.Errorf("%s: got %+v", test.action, r)
+			}
+		}
+	}
+}
+
+func TestAlgoFiStaking(t *testing.T) {
+	const appID, stbl = 553869413, 465865291
+	assetMap := map[uint64]models.Asset{
+		stbl: {Index: stbl, Params: models.AssetParams{UnitName: "STBL", Decimals: 6}},
+	}
+	claim := applGroup(appID, "cr", transfer("STAKING", testAccount, stbl, 500))
+	records, err := ApplAlgoFiStaking(filterGroup(t, claim, assetMap), claim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rewards int
+	for _, r := range records {
+		if r.staking {
+			rewards++
+		}
+	}
+	if rewards != 1 {
+		t.Errorf("got %d staking rewards, want 1", rewards)
+	}
+
+	// The STBL asset ID is not the STBL staking application.
+	for _, test := range []struct {
+		appID   uint64
+		staking bool
+	}{{482608345, true}, {appID, true}, {stbl, false}} {
+		handler, ok := findApplHandler(models.TransactionApplication{ApplicationId: test.appID}, nil)
+		if staking := ok && handler.name == "AlgoFi Staking"; staking != test.staking {
+			t.Errorf("application %d: got AlgoFi Staking %t, want %t", test.appID, staking, test.staking)
+		}
+	}
+
+	for _, onCompletion := range []string{"optin", "closeout"} {
+		txns := applGroup(appID, "")
+		txns[0].ApplicationTransaction.OnCompletion = onCompletion
+		txns[0].ApplicationTransaction.ApplicationArgs = nil
+		if _, err := ApplAlgoFiStaking(filterGroup(t, txns, assetMap), txns); err != nil {
+			t.Errorf("%s: %v", onCompletion, err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+// FolksFinanceStateName is the ApplState name of the Folks Finance lending state.
+const FolksFinanceStateName = "Folks Finance"
+
+func init() {
+	// Folks Finance lending pools, one per asset.
+	// https://docs.folks.finance/developer/contracts
+	registerApplication(applHandler{
+		name: "Folks Finance Lending",
+		match: appIDs(
+			686498781, // ALGO
+			686500029, // USDC
+			686500844, // USDt
+			686501760, // goBTC
+			686502380, // goETH
+		),
+		deferred:   true,
+		persistent: true,
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			var folksState LendingState
+			if err := state.Get(FolksFinanceStateName, &folksState); err != nil {
+				return records, err
+			}
+			processed, folksState, err := ApplFolksFinanceLend(records, txns, folksState)
+			if err != nil {
+				return processed, err
+			}
+			return processed, state.Set(FolksFinanceStateName, folksState)
+		},
+	})
+
+	// Folks Finance liquid governance, ALGO is exchanged for xALGO (or gALGO) and back.
+	// https://docs.folks.finance/xalgo/introduction
+	registerApplication(applHandler{
+		name: "Folks Finance Liquid Governance",
+		match: appIDs(
+			1134695678, // xALGO
+			793119270,  // gALGO
+		),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplFolksFinanceLiquidGovernance(records, txns)
+		},
+	})
+}
+
+// ApplFolksFinanceLend exports Folks Finance lending pool transactions.
+// Deposits mint fTokens, a receipt for the deposited amount which is exported as non taxable, the same as
+// borrowed amounts. Interest is split out of withdrawals as lending income and out of repayments as borrowing fees.
+// https://docs.folks.finance/developer/contracts
+func ApplFolksFinanceLend(records []ExportRecord, txns []models.Transaction, state LendingState) ([]ExportRecord, LendingState, error) {
+	onCompletion, action := ExtractFirstArg(txns)
+	appl, err := ExtractApplication(txns)
+	if err != nil {
+		return records, state, err
+	}
+	split := splitApplRecords(records)
+
+	processed := append([]ExportRecord{}, records...)
+	var extra *ExportRecord
+	switch {
+	// Deposit, minting fTokens.
+	case action == "d" && len(split.withdrawals) == 1 && len(split.deposits) == 1:
+		state.supply(appl.ApplicationId, processed[split.withdrawals[0]])
+		processed[split.withdrawals[0]].comment = "Folks Finance - Deposit"
+		processed[split.deposits[0]].incomeNoTax = true
+		processed[split.deposits[0]].comment = "Folks Finance - Deposit - fToken"
+	// Withdraw, burning fTokens.
+	case action == "r" && len(split.withdrawals) == 1 && len(split.deposits) == 1:
+		i := split.deposits[0]
+		processed[i], extra = state.redeem(appl.ApplicationId, processed[i], "Folks Finance")
+		processed[i].comment = "Folks Finance - Withdraw"
+		processed[split.withdrawals[0]].expenseNoTax = true
+		processed[split.withdrawals[0]].comment = "Folks Finance - Withdraw - fToken"
+	// Borrow, the fToken collateral is locked in the loan escrow of the account.
+	case action == "b" && len(split.deposits) == 1 && len(split.withdrawals) <= 1:
+		i := split.deposits[0]
+		state.borrow(appl.ApplicationId, processed[i])
+		processed[i].incomeNoTax = true
+		processed[i].comment = "Folks Finance - Borrow"
+		for _, i := range split.withdrawals {
+			processed[i].comment = "Folks Finance - Borrow - Collateral"
+		}
+	// Repay, the fToken collateral is released when the loan is repaid in full.
+	case action == "rb" && len(split.withdrawals) == 1 && len(split.deposits) <= 1:
+		i := split.withdrawals[0]
+		processed[i], extra = state.repay(appl.ApplicationId, processed[i], "Folks Finance")
+		processed[i].expenseNoTax = true
+		processed[i].comment = "Folks Finance - Repay"
+		for _, i := range split.deposits {
+			processed[i].comment = "Folks Finance - Repay - Collateral"
+		}
+	// Liquidation of another account, repaying part of its loan for its fToken collateral.
+	case action == "l" && len(split.withdrawals) == 1 && len(split.deposits) == 1:
+		r := processed[split.deposits[0]]
+		w := processed[split.withdrawals[0]]
+		r.appl = true
+		r.trade = true
+		r.sentQty = w.sentQty
+		r.sentASA = w.sentASA
+		if w.sentASA == 0 {
+			r.fee = w.fee // Put fees in same record when trading ALGO -> ASA.
+		}
+		r.comment = "Folks Finance - Liquidation"
+		processed = []ExportRecord{r}
+		for _, i := range split.fees {
+			processed = append(processed, records[i])
+		}
+		for _, i := range split.others {
+			processed = append(processed, records[i])
+		}
+	// Liquidation of the account, its loan and collateral are in the loan escrow so only fees are exported.
+	case action == "l" && len(split.withdrawals) == 0 && len(split.deposits) == 0:
+	// Opt-in of the account or of a new loan escrow, funded by the account with its minimum balance.
+	case onCompletion == "optin" && len(split.withdrawals) <= 1 && len(split.deposits) == 0:
+		for _, i := range split.withdrawals {
+			processed[i].comment = "Folks Finance - Loan Escrow"
+		}
+	// Opt-out of the account, only fees are exported.
+	case onCompletion == "closeout" && action == "" && len(split.withdrawals) == 0 && len(split.deposits) == 0:
+	default:
+		return records, state, fmt.Errorf("invalid ApplFolksFinanceLend() record | onCompletion: %s | action: %s | records length: %d | txns length: %d", onCompletion, action, len(records), len(txns))
+	}
+	if extra != nil {
+		processed = append(processed, *extra)
+	}
+	return processed, state, nil
+}
+
+// ApplFolksFinanceLiquidGovernance exports the exchange of ALGO for xALGO or gALGO, and back, as a trade.
+// Governance rewards claimed without an exchange are staking income.
+// https://docs.folks.finance/xalgo/introduction
+func ApplFolksFinanceLiquidGovernance(records []ExportRecord, txns []models.Transaction) ([]ExportRecord, error) {
+	onCompletion, action := ExtractFirstArg(txns)
+	split := splitApplRecords(records)
+
+	switch {
+	// Mint or burn.
+	case len(split.withdrawals) == 1 && len(split.deposits) == 1:
+		w := records[split.withdrawals[0]]
+		r := records[split.deposits[0]]
+		if w.sentASA != 0 && r.recvASA != 0 {
+			break
+		}
+		r.appl = true
+		r.trade = true
+		r.sentQty = w.sentQty
+		r.sentASA = w.sentASA
+		if w.sentASA == 0 {
+			r.fee = w.fee // Put fees in same record when trading ALGO -> ASA.
+			r.comment = "Folks Finance - Liquid Governance Mint"
+		} else {
+			r.comment = "Folks Finance - Liquid Governance Burn"
+		}
+		processed := []ExportRecord{r}
+		for _, i := range split.fees {
+			processed = append(processed, records[i])
+		}
+		for _, i := range split.others {
+			processed = append(processed, records[i])
+		}
+		return processed, nil
+
+	// Claim governance rewards.
+	case len(split.withdrawals) == 0 && len(split.deposits) > 0:
+		for _, i := range split.deposits {
+			records[i].staking = true
+			records[i].comment = "Folks Finance - Liquid Governance Rewards"
+		}
+		return records, nil
+	}
+
+	return records, fmt.Errorf("invalid ApplFolksFinanceLiquidGovernance() record | onCompletion: %s | action: %s | records length: %d | txns length: %d", onCompletion, action, len(records), len(txns))
+}
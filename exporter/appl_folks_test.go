@@ -0,0 +1,85 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func TestFolksFinanceLend(t *testing.T) {
+	const appID, fALGO = 686498781, 686508050
+	assetMap := map[uint64]models.Asset{
+		fALGO: {Index: fALGO, Params: models.AssetParams{UnitName: "fALGO", Decimals: 6}},
+	}
+	var state LendingState
+	deposit := applGroup(appID, "d", transfer("POOL", testAccount, fALGO, 990), transfer(testAccount, "POOL", 0, 1000))
+	records, state, err := ApplFolksFinanceLend(filterGroup(t, deposit, assetMap), deposit, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r.recvASA == fALGO && !r.incomeNoTax {
+			t.Errorf("fToken deposit is taxable: %+v", r)
+		}
+	}
+	if market := state.Markets[lendingMarketKey(appID, 0)]; market == nil || market.Supply != 1000 {
+		t.Fatalf("got %+v, want a supply of 1000", market)
+	}
+
+	withdraw := applGroup(appID, "r", transfer("POOL", testAccount, 0, 1250), transfer(testAccount, "POOL", fALGO, 990))
+	records, _, err = ApplFolksFinanceLend(filterGroup(t, withdraw, assetMap), withdraw, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var withdrawn, interest uint64
+	for _, r := range records {
+		switch {
+		case r.recvASA == 0 && r.lending:
+			interest += r.recvQty
+		case r.recvASA == 0:
+			withdrawn += r.recvQty
+		}
+	}
+	if withdrawn != 1000 || interest != 250 {
+		t.Errorf("got withdrawn %d, interest %d, want 1000 and 250", withdrawn, interest)
+	}
+
+	liquidate := applGroup(appID, "l", transfer("ESCROW", testAccount, fALGO, 500), transfer(testAccount, "POOL", 0, 400))
+	records, _, err = ApplFolksFinanceLend(filterGroup(t, liquidate, assetMap), liquidate, LendingState{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !records[0].trade || records[0].recvQty != 500 || records[0].sentQty != 400 {
+		t.Errorf("liquidation: got %+v", records[0])
+	}
+
+	// A new loan escrow opts in to the pool, funded by the account.
+	escrow := applGroup(appID, "", transfer(testAccount, "ESCROW", 0, 300000))
+	escrow[0].ApplicationTransaction.OnCompletion = "optin"
+	escrow[0].ApplicationTransaction.ApplicationArgs = nil
+	records, _, err = ApplFolksFinanceLend(filterGroup(t, escrow, assetMap), escrow, LendingState{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if !r.feeTx && r.comment != "Folks Finance - Loan Escrow" {
+			t.Errorf("escrow: got %+v", r)
+		}
+	}
+}
+
+func TestFolksFinanceLiquidGovernance(t *testing.T) {
+	const appID, xALGO = 1134695678, 1134696561
+	assetMap := map[uint64]models.Asset{
+		xALGO: {Index: xALGO, Params: models.AssetParams{UnitName: "xALGO", Decimals: 6}},
+	}
+	mint := applGroup(appID, "mint", transfer("XALGO", testAccount, xALGO, 950), transfer(testAccount, "XALGO", 0, 1000))
+	records, err := ApplFolksFinanceLiquidGovernance(filterGroup(t, mint, assetMap), mint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := records[0]
+	if !r.trade || r.recvASA != xALGO || r.recvQty != 950 || r.sentASA != 0 || r.sentQty != 1000 {
+		t.Errorf("got %+v", r)
+	}
+}
@@ -0,0 +1,75 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func init() {
+	// HumbleSwap deploys an application per pool, so pools other than those listed here are matched by the ABI
+	// method selector of their call.
+	// https://docs.humble.sh/
+	registerApplication(applHandler{
+		name: "HumbleSwap",
+		match: appIDs(
+			771884869, // ALGO/USDC
+			771906437, // ALGO/goBTC
+		),
+		matchCall: isHumbleCall,
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplHumbleSwap(records, txns)
+		},
+	})
+}
+
+// humbleMethods are the ABI methods of the HumbleSwap pool API, by their selector.
+var humbleMethods = abiSelectors(
+	"Trader_swapAForB(uint64,uint64)(uint64,uint64)",
+	"Trader_swapBForA(uint64,uint64)(uint64,uint64)",
+	"Provider_deposit((uint64,uint64),uint256)uint256",
+	"Provider_withdraw(uint256,(uint64,uint64))(uint64,uint64)",
+)
+
+// isHumbleCall matches the call of a HumbleSwap pool method.
+func isHumbleCall(appl models.TransactionApplication) bool {
+	if len(appl.ApplicationArgs) == 0 {
+		return false
+	}
+	_, ok := humbleMethods[string(appl.ApplicationArgs[0])]
+	return ok
+}
+
+// ApplHumbleSwap exports HumbleSwap AMM transactions.
+// The pool methods are ABI selectors, so the action is taken from the records: liquidity is always added and
+// removed with both assets of the pool, and swaps exchange one asset for the other.
+// Treat HumbleSwap LP as a Split Trade, the same as Tinyman.
+// https://cointracking.freshdesk.com/en/support/solutions/articles/29000038185-how-are-liquidity-pool-transactions-imported-
+func ApplHumbleSwap(records []ExportRecord, txns []models.Transaction) ([]ExportRecord, error) {
+	onCompletion, action := ExtractFirstArg(txns)
+	split := splitApplRecords(records)
+
+	switch {
+	// Add liquidity.
+	case len(split.withdrawals) == 2 && len(split.deposits) == 1:
+		if processed, ok := ammAddLiquidity(records, split, "HumbleSwap Liquidity Pool Deposit"); ok {
+			return processed, nil
+		}
+
+	// Remove liquidity, unlike a swap refund neither asset is the withdrawn pool token.
+	case len(split.withdrawals) == 1 && len(split.deposits) == 2 &&
+		records[split.deposits[0]].recvASA != records[split.withdrawals[0]].sentASA &&
+		records[split.deposits[1]].recvASA != records[split.withdrawals[0]].sentASA:
+		if processed, ok := ammRemoveLiquidity(records, split, "HumbleSwap Liquidity Pool Withdrawal"); ok {
+			return processed, nil
+		}
+
+	// Swap
+	case len(split.withdrawals) == 1:
+		if processed, ok := ammSwap(records, split, "HumbleSwap Swap"); ok {
+			return processed, nil
+		}
+	}
+
+	return records, fmt.Errorf("invalid ApplHumbleSwap() record | onCompletion: %s | action: %x | records length: %d | txns length: %d", onCompletion, action, len(records), len(txns))
+}
@@ -0,0 +1,73 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func init() {
+	// Pact deploys an application per pool, so its pools are matched by their application call.
+	// https://docs.pact.fi/
+	registerApplication(applHandler{
+		name:      "Pact",
+		matchCall: isPactCall,
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplPact(records, txns)
+		},
+	})
+}
+
+// isPactCall matches the call of a Pact pool: the action followed by its minimum amounts as uint64 arguments
+// (one for SWAP and ADDLIQ, two for REMLIQ), with the one or two pool assets as foreign assets.
+// Calls of other applications using the same action names rarely have this exact shape.
+func isPactCall(appl models.TransactionApplication) bool {
+	if len(appl.ApplicationArgs) == 0 || len(appl.ForeignAssets) == 0 || len(appl.ForeignAssets) > 2 {
+		return false
+	}
+	var amounts int
+	switch string(appl.ApplicationArgs[0]) {
+	case "SWAP", "ADDLIQ":
+		amounts = 1
+	case "REMLIQ":
+		amounts = 2
+	default:
+		return false
+	}
+	if len(appl.ApplicationArgs) != 1+amounts {
+		return false
+	}
+	for _, arg := range appl.ApplicationArgs[1:] {
+		if len(arg) != 8 {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplPact exports Pact AMM transactions, the pool sends its output in inner transactions of the application call.
+// Treat Pact LP as a Split Trade, the same as Tinyman.
+// https://cointracking.freshdesk.com/en/support/solutions/articles/29000038185-how-are-liquidity-pool-transactions-imported-
+func ApplPact(records []ExportRecord, txns []models.Transaction) ([]ExportRecord, error) {
+	onCompletion, action := ExtractFirstArg(txns)
+	split := splitApplRecords(records)
+
+	switch action {
+	case "SWAP":
+		if processed, ok := ammSwap(records, split, "Pact Swap"); ok {
+			return processed, nil
+		}
+
+	case "ADDLIQ":
+		if processed, ok := ammAddLiquidity(records, split, "Pact Liquidity Pool Deposit"); ok {
+			return processed, nil
+		}
+
+	case "REMLIQ":
+		if processed, ok := ammRemoveLiquidity(records, split, "Pact Liquidity Pool Withdrawal"); ok {
+			return processed, nil
+		}
+	}
+
+	return records, fmt.Errorf("invalid ApplPact() record | onCompletion: %s | action: %s | records length: %d | txns length: %d", onCompletion, action, len(records), len(txns))
+}
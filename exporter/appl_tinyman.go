@@ -6,6 +6,19 @@ import (
 	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
 )
 
+func init() {
+	// https://docs.tinyman.org/contracts
+	// Version 1.1 - Mainnet Validator App ID: 552635992
+	// Version 1.0 - Mainnet Validator App ID: 350338509
+	registerApplication(applHandler{
+		name:  "Tinyman",
+		match: appIDs(552635992, 350338509),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplTinyman(records, txns)
+		},
+	})
+}
+
 // ApplTinyman exports Tinyman Liquidity Pool transactions.
 // https://docs.tinyman.org/contracts
 // Version 1.1 - Mainnet Validator App ID: 552635992
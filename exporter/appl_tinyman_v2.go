@@ -0,0 +1,143 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func init() {
+	// https://docs.tinyman.org/v/tinyman-v2/contracts
+	// Version 2 - Mainnet Validator App ID: 1002541853
+	registerApplication(applHandler{
+		name:  "Tinyman V2",
+		match: appIDs(1002541853),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplTinymanV2(records, txns)
+		},
+	})
+}
+
+// ApplTinymanV2 exports Tinyman V2 AMM transactions.
+// Unlike V1, the pool sends its output in inner transactions of the application call.
+// Treat Tinyman LP as a Split Trade, the same as V1.
+// https://cointracking.freshdesk.com/en/support/solutions/articles/29000038185-how-are-liquidity-pool-transactions-imported-
+func ApplTinymanV2(records []ExportRecord, txns []models.Transaction) ([]ExportRecord, error) {
+	onCompletion, action := ExtractFirstArg(txns)
+	split := splitApplRecords(records)
+
+	switch action {
+	// Swap (fixed-input or fixed-output).
+	case "swap":
+		if processed, ok := ammSwap(records, split, "Tinyman V2 Swap"); ok {
+			return processed, nil
+		}
+
+	// Add liquidity with one (single) or both (flexible, initial) assets of the pool.
+	case "add_liquidity", "add_initial_liquidity":
+		if processed, ok := ammAddLiquidity(records, split, "Tinyman V2 Liquidity Pool Deposit"); ok {
+			return processed, nil
+		}
+
+	// Remove liquidity to one (single) or both assets of the pool.
+	case "remove_liquidity":
+		if processed, ok := ammRemoveLiquidity(records, split, "Tinyman V2 Liquidity Pool Withdrawal"); ok {
+			return processed, nil
+		}
+
+	// Flash loan, the loan is repaid in the same group with a fee.
+	case "flash_loan":
+		return tinymanV2FlashLoan(records, txns, split), nil
+	}
+
+	return records, fmt.Errorf("invalid ApplTinymanV2() record | onCompletion: %s | action: %s | records length: %d | txns length: %d", onCompletion, action, len(records), len(txns))
+}
+
+// tinymanV2FlashLoan exports the loans of a flash loan group, sent by the pool in the inner transactions of the
+// flash_loan call, and their repayments to the pool, paired by asset. Any repaid amount above the loan is a fee.
+// The other transfers of the group (e.g. the swaps the loan pays for) are left as they are for the unclassified
+// report, and so is the whole group if a loan is not repaid in full.
+func tinymanV2FlashLoan(records []ExportRecord, txns []models.Transaction, split applRecords) []ExportRecord {
+	var pool string
+	for _, tx := range txns {
+		appl := tx.ApplicationTransaction
+		if tx.Type == "appl" && len(appl.ApplicationArgs) > 0 && string(appl.ApplicationArgs[0]) == "flash_loan" {
+			for _, inner := range tx.InnerTxns {
+				pool = inner.Sender
+			}
+		}
+	}
+	loans := map[uint64]uint64{}
+	for _, i := range split.deposits {
+		if r := records[i]; pool != "" && r.sender == pool {
+			loans[r.recvASA] += r.recvQty
+		}
+	}
+	if len(loans) == 0 {
+		return unclassifiedRecords(records, "Tinyman V2 flash loan without a loan")
+	}
+
+	var processed []ExportRecord
+	paired := map[int]bool{}
+	for _, i := range split.deposits {
+		if r := records[i]; r.sender == pool {
+			r.incomeNoTax = true
+			r.comment = "Tinyman V2 Flash Loan"
+			processed = append(processed, r)
+			paired[i] = true
+		}
+	}
+	remaining := map[uint64]uint64{}
+	for assetID, qty := range loans {
+		remaining[assetID] = qty
+	}
+	for _, i := range split.withdrawals {
+		r := records[i]
+		if _, ok := loans[r.sentASA]; !ok || r.receiver != pool {
+			continue
+		}
+		paired[i] = true
+		// The ALGO repayment includes the transaction fee.
+		qty := r.sentQty
+		if r.sentASA == 0 {
+			qty -= r.fee
+		}
+		repaid := qty
+		if repaid > remaining[r.sentASA] {
+			repaid = remaining[r.sentASA]
+		}
+		remaining[r.sentASA] -= repaid
+		excess := qty - repaid
+		if repaid > 0 {
+			repay := r
+			repay.sentQty = r.sentQty - excess
+			repay.expenseNoTax = true
+			repay.comment = "Tinyman V2 Flash Loan - Repay"
+			processed = append(processed, repay)
+		}
+		if excess > 0 {
+			fee := r
+			if repaid > 0 {
+				fee.sentQty = excess
+				fee.fee = 0
+			}
+			fee.borrow = true
+			fee.comment = "Tinyman V2 Flash Loan - Fee"
+			processed = append(processed, fee)
+		}
+	}
+	for _, qty := range remaining {
+		if qty > 0 {
+			return unclassifiedRecords(records, "Tinyman V2 flash loan not repaid in full")
+		}
+	}
+
+	for _, transfers := range [][]int{split.deposits, split.withdrawals} {
+		for _, i := range transfers {
+			if !paired[i] {
+				processed = append(processed, unclassifiedRecords([]ExportRecord{records[i]}, "Tinyman V2 flash loan group with other transfers")...)
+			}
+		}
+	}
+	return appendApplFees(processed, records, split)
+}
@@ -7,6 +7,91 @@ import (
 	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
 )
 
+func init() {
+	// Yieldly No-Loss Lottery.
+	// https://app.yieldly.finance/algo-prize-game
+	registerApplication(applHandler{
+		name:  "Yieldly ALGO Prize Game",
+		match: appIDs(233725844),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplYieldlyAlgoPrizeGame(records, txns)
+		},
+	})
+
+	// Yieldly Staking Pool one to two.
+	registerApplication(applHandler{
+		name:  "Yieldly Staking Pool YLDY/ALGO",
+		match: appIDs(233725850), // YLDY -> YLDY/ALGO
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplYieldlyStakingPoolsYLDYALGO(records, txns)
+		},
+	})
+
+	// Yieldly Staking Pools one to one.
+	// https://app.yieldly.finance/pools
+	registerApplication(applHandler{
+		name: "Yieldly Staking Pools",
+		match: appIDs(
+			348079765, // YLDY -> OPUL
+			352116819, // YLDY -> SMILE
+			367431051, // OPUL -> OPUL
+			373819681, // SMILE -> SMILE
+			385089192, // YLDY -> ARCC
+			393388133, // YLDY -> GEMS
+			419301793, // GEMS -> GEMS
+			424101057, // YLDY -> XET
+			447336112, // YLDY -> CHOICE
+			464365150, // CHOICE -> CHOICE
+			498747685, // ARCC -> ARCC
+			511597182, // YLDY -> AKITA
+			583357499, // YLDY -> ARCC
+			593126242, // YLDY -> KTNC
+			591414576, // YLDY -> DEFLY
+			593270704, // YLDY -> TINY
+			593289960, // YLDY -> TREES
+			593324268, // YLDY -> BLOCK
+			596950925, // YLDY -> HDL
+		),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplYieldlyStakingPools(records, txns)
+		},
+	})
+
+	// Yieldly Liquidity Pools.
+	// https://app.yieldly.finance/liquidity-pools
+	registerApplication(applHandler{
+		name: "Yieldly Liquidity Pools",
+		match: appIDs(
+			511593477, // AKITA/ALGO LP -> YLDY
+			556355279, // AKTA/ALGO LP -> YLDY
+			568949192, // XET/YLDY LP -> YLDY
+			583355704, // ARCC/YLDY LP -> YLDY
+			591416743, // DEFLY/YLDY LP -> YLDY
+			593133882, // KTNC/YLDY LP -> YLDY
+			593278929, // TINY/YLDY LP -> YLDY
+			593294372, // TREES/YLDY LP -> YLDY
+			593337625, // BLOCK/YLDY LP -> YLDY
+			596954871, // HDL/YLDY LP -> YLDY
+		),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplYieldlyLiquidityPools(records, txns)
+		},
+	})
+
+	// Yieldly Distribution Pools.
+	// https://app.yieldly.finance/distribution
+	registerApplication(applHandler{
+		name: "Yieldly Distribution Pools",
+		match: appIDs(
+			470390215, // XET -> XET
+			596947890, // HDL -> HDL
+		),
+		process: func(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState) ([]ExportRecord, error) {
+			return ApplYieldlyDistributionPools(records, txns)
+		},
+	})
+}
+
 // https://app.yieldly.finance/algo-prize-game
 func ApplYieldlyAlgoPrizeGame(records []ExportRecord,  txns []models.Transaction) ([]ExportRecord, error) {
 	onCompletion, action := ExtractFirstArg(txns)
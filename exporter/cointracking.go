@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"strings"
@@ -29,11 +30,15 @@ func (k *cointrackingExporter) WriteHeader(writer io.Writer) {
 	// "Type", "Buy Amount", "Buy Currency", "Sell Amount", "Sell Currency", "Fee", "Fee Currency", "Exchange", "Trade-Group", "Comment", "Date"
 	// Optionally you can add those 3 columns at the end (after the "Date" column):
 	// "Tx-ID", "Buy Value in your Account Currency", "Sell Value in your Account Currency"
-	fmt.Fprintln(writer, "Type,Buy Amount,Buy Currency,Sell Amount,Sell Currency,Fee,Fee Currency,Exchange,Trade-Group,Comment,Date,Tx-ID")
+	fmt.Fprintln(writer, "Type,Buy Amount,Buy Currency,Sell Amount,Sell Currency,Fee,Fee Currency,Exchange,Trade-Group,Comment,Date,Tx-ID,Buy Value in your Account Currency,Sell Value in your Account Currency")
 }
 
-func (k *cointrackingExporter) WriteRecord(writer io.Writer, assetMap map[uint64]models.Asset, record ExportRecord) {
-	// Type,Buy Amount,Buy Currency,Sell Amount,Sell Currency,Fee,Fee Currency,Exchange,Trade-Group,Comment,Date,Tx-ID
+func (k *cointrackingExporter) WriteRecord(out io.Writer, assetMap map[uint64]models.Asset, record ExportRecord) error {
+	// The record is formatted in full first, so nothing is written to out if an asset is unknown.
+	writer := &bytes.Buffer{}
+	f := newAssetFormatter(assetMap)
+
+	// Type,Buy Amount,Buy Currency,Sell Amount,Sell Currency,Fee,Fee Currency,Exchange,Trade-Group,Comment,Date,Tx-ID,Buy Value in your Account Currency,Sell Value in your Account Currency
 
 	// Type,
 	// https://cointracking.freshdesk.com/en/support/solutions/articles/29000034379-expanded-transaction-types-may-2020-
@@ -70,7 +75,7 @@ func (k *cointrackingExporter) WriteRecord(writer io.Writer, assetMap map[uint64
 	case record.recvCustomQty != "" && record.recvCustomCurrency != "":
 		fmt.Fprintf(writer, "%s,%s,", record.recvCustomQty, record.recvCustomCurrency)
 	case record.recvQty != 0:
-		fmt.Fprintf(writer, "%s,%s,", assetIDFmt(record.recvQty, record.recvASA, assetMap), asaFmt(record.recvASA, assetMap))
+		fmt.Fprintf(writer, "%s,%s,", f.amount(record.recvQty, record.recvASA), f.currency(record.recvASA))
 	default:
 		fmt.Fprintf(writer, ",,")
 	}
@@ -79,7 +84,7 @@ func (k *cointrackingExporter) WriteRecord(writer io.Writer, assetMap map[uint64
 	case record.sentCustomQty != "" && record.sentCustomCurrency != "":
 		fmt.Fprintf(writer, "%s,%s,", record.sentCustomQty, record.sentCustomCurrency)
 	case record.sentQty != 0:
-		fmt.Fprintf(writer, "%s,%s,", assetIDFmt(record.sentQty, record.sentASA, assetMap), asaFmt(record.sentASA, assetMap))
+		fmt.Fprintf(writer, "%s,%s,", f.amount(record.sentQty, record.sentASA), f.currency(record.sentASA))
 	default:
 		fmt.Fprintf(writer, ",,")
 	}
@@ -101,11 +106,11 @@ func (k *cointrackingExporter) WriteRecord(writer io.Writer, assetMap map[uint64
 
 	// Comment,
 	var comments []string
-	if record.recvASA != 0 && asaComment(record.recvASA, assetMap) != "" {
-		comments = append(comments, asaComment(record.recvASA, assetMap))
+	if comment := f.comment(record.recvASA); comment != "" {
+		comments = append(comments, comment)
 	}
-	if record.sentASA != 0 && record.recvASA != record.sentASA && asaComment(record.sentASA, assetMap) != "" {
-		comments = append(comments, asaComment(record.sentASA, assetMap))
+	if comment := f.comment(record.sentASA); comment != "" && record.recvASA != record.sentASA {
+		comments = append(comments, comment)
 	}
 	if record.comment != "" {
 		comments = append(comments, record.comment)
@@ -138,5 +143,13 @@ func (k *cointrackingExporter) WriteRecord(writer io.Writer, assetMap map[uint64
 	case record.reward:
 		fmt.Fprintf(writer, "_reward")
 	}
+
+	// Buy Value in your Account Currency,Sell Value in your Account Currency
+	fmt.Fprintf(writer, ",%s,%s", record.recvValue, record.sentValue)
 	fmt.Fprint(writer, "\n")
+	if f.err != nil {
+		return f.err
+	}
+	_, err := out.Write(writer.Bytes())
+	return err
 }
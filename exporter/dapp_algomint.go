@@ -36,6 +36,7 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		return records, fmt.Errorf("invalid DAppAlgomint() record")
 	}
 	var processed []ExportRecord
+	f := newAssetFormatter(assetMap)
 
 	r := records[0]
 	
@@ -62,7 +63,7 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 	if r.IsAssetIDDeposit(386192725) && IsLengthExcludeReward(records, 1) {
 		processed = append(processed, records...)
 		processed[0].comment = "Algomint - Mint goBTC"
-		processed[0].sentCustomQty = assetIDFmt(processed[0].recvQty, processed[0].recvASA, assetMap)
+		processed[0].sentCustomQty = f.amount(processed[0].recvQty, processed[0].recvASA)
 		processed[0].sentCustomCurrency = "BTC"
 
 		btcDepositRecord := records[0]
@@ -71,7 +72,7 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		btcDepositRecord.sentQty = 0
 		btcDepositRecord.sentASA = 0
 		btcDepositRecord.topTxID = "btc-deposit-" + records[0].txid
-		btcDepositRecord.recvCustomQty = assetIDFmt(records[0].recvQty, records[0].recvASA, assetMap)
+		btcDepositRecord.recvCustomQty = f.amount(records[0].recvQty, records[0].recvASA)
 		btcDepositRecord.recvCustomCurrency = "BTC"
 		btcDepositRecord.comment = "Algomint - Mint goBTC - BTC deposit"
 		processed = append(processed, btcDepositRecord)
@@ -106,7 +107,7 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		// 0.2% minting fee charged by Algomint. 0% Until 12.01am AEST the 1st of March 2022.
 		// 12:01 AM Sunday, Australian Eastern Standard Time (AEST) is 2:01 PM Saturday, Coordinated Universal Time (UTC).
 		if processed[0].blockTime.After(time.Date(2022, 3, 1, 14, 0, 1, 0, time.UTC)) {
-			recvQty, err := decimal.NewFromString(assetIDFmt(processed[0].recvQty, processed[0].recvASA, assetMap))
+			recvQty, err := decimal.NewFromString(f.amount(processed[0].recvQty, processed[0].recvASA))
 			if err != nil {
 				return processed, err
 			}
@@ -142,7 +143,7 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 			mintingDepositRecord.comment = "Algomint - Mint goBTC - minting fee deposit"
 			processed = append(processed, mintingDepositRecord)
 		}
-		return processed, nil
+		return processed, f.err
 	}
 	
 	// Unlock goBTC
@@ -161,8 +162,8 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		miningRecord.topTxID = "mining-fee-" + miningRecord.txid
 		miningRecord.sentQty = 100000
 		miningRecord.sentASA = processed[0].sentASA
-		miningRecord.feeCustom = assetIDFmt(miningRecord.sentQty, miningRecord.sentASA, assetMap)
-		miningRecord.feeCustomCurrency = asaFmt(miningRecord.sentASA, assetMap)
+		miningRecord.feeCustom = f.amount(miningRecord.sentQty, miningRecord.sentASA)
+		miningRecord.feeCustomCurrency = f.currency(miningRecord.sentASA)
 		miningRecord.comment = "Algomint - Unlock goBTC - mining fee"
 		processed = append(processed, miningRecord)
 
@@ -179,19 +180,19 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		burningRecord.topTxID = "minting-fee-" + burningRecord.txid
 		burningRecord.sentQty = burningFee
 		burningRecord.sentASA = processed[0].sentASA
-		burningRecord.feeCustom = assetIDFmt(burningRecord.sentQty, burningRecord.sentASA, assetMap)
-		burningRecord.feeCustomCurrency = asaFmt(burningRecord.sentASA, assetMap)
+		burningRecord.feeCustom = f.amount(burningRecord.sentQty, burningRecord.sentASA)
+		burningRecord.feeCustomCurrency = f.currency(burningRecord.sentASA)
 		burningRecord.comment = "Algomint - Unlock goBTC - burning fee"
 		processed = append(processed, burningRecord)
 
-		return processed, nil
+		return processed, f.err
 	}
 	
 	// Mint goETH
 	if r.IsAssetIDDeposit(386195940) && IsLengthExcludeReward(records, 1) {
 		processed = append(processed, records...)
 		processed[0].comment = "Algomint - Mint goETH"
-		processed[0].sentCustomQty = assetIDFmt(processed[0].recvQty, processed[0].recvASA, assetMap)
+		processed[0].sentCustomQty = f.amount(processed[0].recvQty, processed[0].recvASA)
 		processed[0].sentCustomCurrency = "ETH"
 
 		ethDepositRecord := records[0]
@@ -200,7 +201,7 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		ethDepositRecord.sentQty = 0
 		ethDepositRecord.sentASA = 0
 		ethDepositRecord.topTxID = "eth-deposit-" + records[0].txid
-		ethDepositRecord.recvCustomQty = assetIDFmt(records[0].recvQty, records[0].recvASA, assetMap)
+		ethDepositRecord.recvCustomQty = f.amount(records[0].recvQty, records[0].recvASA)
 		ethDepositRecord.recvCustomCurrency = "ETH"
 		ethDepositRecord.comment = "Algomint - Mint goETH - ETH deposit"
 		processed = append(processed, ethDepositRecord)
@@ -235,7 +236,7 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		// 0.2% minting fee charged by Algomint. 0% Until 12.01am AEST the 1st of March 2022.
 		// 12:01 AM Sunday, Australian Eastern Standard Time (AEST) is 2:01 PM Saturday, Coordinated Universal Time (UTC).
 		if processed[0].blockTime.After(time.Date(2022, 3, 1, 14, 0, 1, 0, time.UTC)) {
-			recvQty, err := decimal.NewFromString(assetIDFmt(processed[0].recvQty, processed[0].recvASA, assetMap))
+			recvQty, err := decimal.NewFromString(f.amount(processed[0].recvQty, processed[0].recvASA))
 			if err != nil {
 				return processed, err
 			}
@@ -271,7 +272,7 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 			mintingDepositRecord.comment = "Algomint - Mint goETH - minting fee deposit"
 			processed = append(processed, mintingDepositRecord)
 		}
-		return processed, nil
+		return processed, f.err
 	}
 	
 	// Unlock goETH
@@ -290,8 +291,8 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		miningRecord.topTxID = "mining-fee-" + miningRecord.txid
 		miningRecord.sentQty = 2500000
 		miningRecord.sentASA = processed[0].sentASA
-		miningRecord.feeCustom = assetIDFmt(miningRecord.sentQty, miningRecord.sentASA, assetMap)
-		miningRecord.feeCustomCurrency = asaFmt(miningRecord.sentASA, assetMap)
+		miningRecord.feeCustom = f.amount(miningRecord.sentQty, miningRecord.sentASA)
+		miningRecord.feeCustomCurrency = f.currency(miningRecord.sentASA)
 		miningRecord.comment = "Algomint - Unlock goETH - mining fee"
 		processed = append(processed, miningRecord)
 
@@ -308,12 +309,12 @@ func DAppAlgomint(records []ExportRecord, assetMap map[uint64]models.Asset) ([]E
 		burningRecord.topTxID = "minting-fee-" + burningRecord.txid
 		burningRecord.sentQty = burningFee
 		burningRecord.sentASA = processed[0].sentASA
-		burningRecord.feeCustom = assetIDFmt(burningRecord.sentQty, burningRecord.sentASA, assetMap)
-		burningRecord.feeCustomCurrency = asaFmt(burningRecord.sentASA, assetMap)
+		burningRecord.feeCustom = f.amount(burningRecord.sentQty, burningRecord.sentASA)
+		burningRecord.feeCustomCurrency = f.currency(burningRecord.sentASA)
 		burningRecord.comment = "Algomint - Unlock goETH - burning fee"
 		processed = append(processed, burningRecord)
 
-		return processed, nil
+		return processed, f.err
 	}
 
 	return records, fmt.Errorf("invalid DAppAlgomint() record | records length: %d", len(records))
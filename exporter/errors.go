@@ -0,0 +1,78 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+var (
+	// ErrUnknownAsset is matched by errors.Is for an asset missing from the assetMap.
+	ErrUnknownAsset = errors.New("unknown asset")
+	// ErrUnknownTransactionType is matched by errors.Is for a transaction type FilterTransaction does not export.
+	ErrUnknownTransactionType = errors.New("unknown transaction type")
+)
+
+// UnknownAssetError is returned when an asset is missing from the assetMap, i.e. it was never looked up.
+type UnknownAssetError struct {
+	AssetID uint64
+}
+
+func (e *UnknownAssetError) Error() string {
+	return fmt.Sprintf("unknown asset ID %d", e.AssetID)
+}
+
+func (e *UnknownAssetError) Is(target error) bool {
+	return target == ErrUnknownAsset
+}
+
+// UnknownTransactionTypeError is returned by FilterTransaction for a transaction type it does not export.
+type UnknownTransactionTypeError struct {
+	TxID string
+	Type string
+}
+
+func (e *UnknownTransactionTypeError) Error() string {
+	return fmt.Sprintf("unknown transaction type %q of transaction %s", e.Type, e.TxID)
+}
+
+func (e *UnknownTransactionTypeError) Is(target error) bool {
+	return target == ErrUnknownTransactionType
+}
+
+// assetFormatter formats the amounts and names of assets, keeping the first error,
+// so a record is formatted in full before checking err.
+type assetFormatter struct {
+	assetMap map[uint64]models.Asset
+	err      error
+}
+
+func newAssetFormatter(assetMap map[uint64]models.Asset) *assetFormatter {
+	return &assetFormatter{assetMap: assetMap}
+}
+
+func (f *assetFormatter) keep(s string, err error) string {
+	if f.err == nil {
+		f.err = err
+	}
+	return s
+}
+
+// amount formats amount in the decimals of assetID, see assetIDFmt.
+func (f *assetFormatter) amount(amount, assetID uint64) string {
+	return f.keep(assetIDFmt(amount, assetID, f.assetMap))
+}
+
+// currency is the currency name of assetID, see asaFmt.
+func (f *assetFormatter) currency(assetID uint64) string {
+	return f.keep(asaFmt(assetID, f.assetMap))
+}
+
+func (f *assetFormatter) unitName(assetID uint64) string {
+	return f.keep(asaUnitName(assetID, f.assetMap))
+}
+
+func (f *assetFormatter) comment(assetID uint64) string {
+	return f.keep(asaComment(assetID, f.assetMap))
+}
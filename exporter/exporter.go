@@ -4,7 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"log"
+	"sort"
 	"strconv"
 	"time"
 
@@ -27,6 +27,7 @@ func Formats() []string {
 	for format := range formats {
 		formatNams = append(formatNams, format)
 	}
+	sort.Strings(formatNams)
 	return formatNams
 }
 
@@ -60,6 +61,10 @@ type ExportRecord struct {
 	feeCustom          string
 	feeCustomCurrency  string
 
+	recvValue     string // Value of the received amount in valueCurrency.
+	sentValue     string // Value of the sent amount in valueCurrency.
+	valueCurrency string
+
 	airdrop      bool  // Is this an airdrop - treat as income.
 	appl         bool  // Is this an application.
 	borrow       bool  // used for fees due from borrowing currencies. [Fee Report]
@@ -74,6 +79,8 @@ type ExportRecord struct {
 	trade        bool  // Is this a trade transaction.
 	feeTx        bool  // Is this a fee transaction.
 
+	unclassified string // Why the record could not be classified, e.g. no application handler.
+
 	txRaw   models.Transaction
 	account string
 }
@@ -98,72 +105,69 @@ func appendPostFilter(records []ExportRecord, record ExportRecord) []ExportRecor
 type Interface interface {
 	Name() string
 	WriteHeader(writer io.Writer)
-	WriteRecord(writer io.Writer, assetMap map[uint64]models.Asset, record ExportRecord)
+	// WriteRecord writes a record, nothing is written if it returns an error (e.g. an *UnknownAssetError).
+	WriteRecord(writer io.Writer, assetMap map[uint64]models.Asset, record ExportRecord) error
 }
 
 func algoFmt(algos uint64) string {
 	return fmt.Sprintf("%.6f", types.MicroAlgos(algos).ToAlgos())
 }
 
-func assetIDFmt(amount, assetID uint64, assetMap map[uint64]models.Asset) string {
+func assetIDFmt(amount, assetID uint64, assetMap map[uint64]models.Asset) (string, error) {
 	if assetID == 0 {
-		return algoFmt(amount)
+		return algoFmt(amount), nil
 	}
 	if val, ok := assetMap[assetID]; ok {
 		if val.Params.Decimals != 0 {
 			// models.Params.Decimals must be between 0 and 19 (inclusive).
 			tokens := decimal.RequireFromString(strconv.FormatUint(amount, 10))
-			return tokens.Shift(int32(val.Params.Decimals) * -1).StringFixed(int32(val.Params.Decimals))
+			return tokens.Shift(int32(val.Params.Decimals) * -1).StringFixed(int32(val.Params.Decimals)), nil
 		}
-		return strconv.FormatUint(amount, 10)
+		return strconv.FormatUint(amount, 10), nil
 	}
-	log.Fatalln("unknown decimal amount for AssetID:", assetID)
-	return strconv.FormatUint(amount, 10)
+	return strconv.FormatUint(amount, 10), &UnknownAssetError{AssetID: assetID}
 }
 
-func asaFmt(assetID uint64, assetMap map[uint64]models.Asset) string {
+func asaFmt(assetID uint64, assetMap map[uint64]models.Asset) (string, error) {
 	if assetID == 0 {
-		return "ALGO"
+		return "ALGO", nil
 	}
 	val, ok := assetMap[assetID]
 	if !ok {
-		log.Fatalln("unknown unit name for AssetID:", assetID)
-		return ""
+		return "", &UnknownAssetError{AssetID: assetID}
 	}
 	if asaName, ok := verifiedASA[assetID]; ok {
 		if asaName != "" {
-			return asaName
+			return asaName, nil
 		}
-		return val.Params.UnitName
+		return val.Params.UnitName, nil
 	}
-	return fmt.Sprintf("%x", assetID % 4294967295)  // Limit to 8 characters.
+	return fmt.Sprintf("%x", assetID % 4294967295), nil  // Limit to 8 characters.
 }
 
-func asaUnitName(assetID uint64, assetMap map[uint64]models.Asset) string {
+func asaUnitName(assetID uint64, assetMap map[uint64]models.Asset) (string, error) {
 	if assetID == 0 {
-		return "ALGO"
+		return "ALGO", nil
 	}
 	val, ok := assetMap[assetID]
 	if !ok {
-		log.Fatalln("unknown unit name for AssetID:", assetID)
-		return ""
+		return "", &UnknownAssetError{AssetID: assetID}
 	}
-	return val.Params.UnitName
+	return val.Params.UnitName, nil
 }
 
-func asaComment(assetID uint64, assetMap map[uint64]models.Asset) string {
+func asaComment(assetID uint64, assetMap map[uint64]models.Asset) (string, error) {
 	if assetID == 0 {
-		return ""
+		return "", nil
 	}
 	if _, ok := verifiedASA[assetID]; ok {
-		return ""
+		return "", nil
 	}
 	val, ok := assetMap[assetID]
 	if !ok {
-		log.Fatalln("unknown unit name for AssetID:", assetID)
-		return ""
+		return "", &UnknownAssetError{AssetID: assetID}
 	}
-	return fmt.Sprintf("%s-%d | %s", val.Params.UnitName, assetID, val.Params.Name)
+	return fmt.Sprintf("%s-%d | %s", val.Params.UnitName, assetID, val.Params.Name), nil
 }
 
 func (r ExportRecord) IsALGODeposit() bool {
@@ -206,6 +210,11 @@ func (r ExportRecord) IsWithdrawal() bool {
 	return (r.recvQty == 0 && r.sentQty != 0 && !r.feeTx) || (r.recvCustomQty == "" && r.sentCustomQty != "" && !r.otherFee)
 }
 
+// Unclassified returns why the record was exported as a plain deposit or withdrawal, or "" if it was classified.
+func (r ExportRecord) Unclassified() string {
+	return r.unclassified
+}
+
 func (r ExportRecord) String() string {
 	return fmt.Sprintf("| TopTxID: %s | txID: %s | Group: %s | recv: %d %d | sent: %d %d | sender: %s | receiver: %s | comment: %s", r.topTxID, r.txid, base64.StdEncoding.EncodeToString(r.txRaw.Group), r.recvQty, r.recvASA, r.sentQty, r.sentASA, r.sender, r.receiver, r.comment)
 }
@@ -217,7 +226,6 @@ func (r ExportRecord) DecodeNote() (string, error) {
 	note := base64.StdEncoding.EncodeToString(r.txRaw.Note)
 	decoded, err := base64.StdEncoding.DecodeString(note)
 	if err != nil {
-		fmt.Println("decode error:", err)
 		return "", err
 	}
 	return string(decoded), nil
@@ -265,7 +273,7 @@ func ExtractFirstArg(txns []models.Transaction) (string, string) {
 // Tracking apps seem to treat 'fees' a little differently and seem to assume they're specifically for trades.
 // Since this code is focused on on-chain send/receive activity, the fees are better expressed as 'total send' amount
 // send amount + tx fee, vs receive amount.  The tracking sites will then express that as a chain fee.
-func FilterTransaction(tx models.Transaction, topTxID, account string, assetMap map[uint64]models.Asset) []ExportRecord {
+func FilterTransaction(tx models.Transaction, topTxID, account string, assetMap map[uint64]models.Asset) ([]ExportRecord, error) {
 	var (
 		blockTime  = time.Unix(int64(tx.RoundTime), 0).UTC()
 		recvAmount uint64
@@ -475,8 +483,24 @@ func FilterTransaction(tx models.Transaction, topTxID, account string, assetMap
 			})
 			rewards = tx.SenderRewards
 		}
+	case "stpf", "hb":
+		// State proof and heartbeat transactions move no funds, only a fee paid by the account is exported.
+		if tx.Sender == account && tx.Fee != 0 {
+			records = appendPostFilter(records, ExportRecord{
+				blockTime: blockTime,
+				topTxID:   topTxID,
+				txid:      tx.Id,
+				sentQty:   tx.Fee,
+				fee:       tx.Fee,
+				sender:    account,
+				feeTx:     true,
+				txRaw:     tx,
+				account:   account,
+			})
+			rewards = tx.SenderRewards
+		}
 	default:
-		log.Fatalln("unknown transaction type:", tx.Type)
+		return nil, &UnknownTransactionTypeError{TxID: tx.Id, Type: tx.Type}
 	}
 
 	// now handle rewards (effectively us receiving them - either we sent and received pending rewards
@@ -497,5 +521,5 @@ func FilterTransaction(tx models.Transaction, topTxID, account string, assetMap
 			account:   account,
 		})
 	}
-	return records
+	return records, nil
 }
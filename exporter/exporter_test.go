@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+const testAccount = "TESTACCOUNTTESTACCOUNTTESTACCOUNTTESTACCOUNTTESTACCOUNTTE"
+
+func TestFilterTransactionUnknownType(t *testing.T) {
+	tx := models.Transaction{Id: "TX", Type: "newtype", Sender: testAccount}
+	records, err := FilterTransaction(tx, "", testAccount, map[uint64]models.Asset{})
+	if !errors.Is(err, ErrUnknownTransactionType) {
+		t.Fatalf("got error %v, want ErrUnknownTransactionType", err)
+	}
+	var typeErr *UnknownTransactionTypeError
+	if !errors.As(err, &typeErr) || typeErr.Type != "newtype" || typeErr.TxID != "TX" {
+		t.Errorf("got %#v", typeErr)
+	}
+	if len(records) != 0 {
+		t.Errorf("got %d records, want none", len(records))
+	}
+}
+
+func TestWriteRecordUnknownAsset(t *testing.T) {
+	tx := models.Transaction{
+		Id:     "TX",
+		Type:   "axfer",
+		Sender: "SENDER",
+		AssetTransferTransaction: models.TransactionAssetTransfer{
+			AssetId:  31566704,
+			Amount:   1000000,
+			Receiver: testAccount,
+		},
+	}
+	records, err := FilterTransaction(tx, "", testAccount, map[uint64]models.Asset{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range Formats() {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			err := GetFormatter(format).WriteRecord(&out, map[uint64]models.Asset{}, records[0])
+			if !errors.Is(err, ErrUnknownAsset) {
+				t.Fatalf("got error %v, want ErrUnknownAsset", err)
+			}
+			var assetErr *UnknownAssetError
+			if !errors.As(err, &assetErr) || assetErr.AssetID != 31566704 {
+				t.Errorf("got %#v", assetErr)
+			}
+			if out.Len() != 0 {
+				t.Errorf("a partial record was written: %q", out.String())
+			}
+
+			assetMap := map[uint64]models.Asset{
+				31566704: {Index: 31566704, Params: models.AssetParams{UnitName: "USDC", Decimals: 6}},
+			}
+			if err := GetFormatter(format).WriteRecord(&out, assetMap, records[0]); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(out.Bytes(), []byte("1.000000")) {
+				t.Errorf("got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestFilterTransactionTypes(t *testing.T) {
+	assetMap := map[uint64]models.Asset{}
+	for _, test := range []struct {
+		txType string
+		sender string
+		fee    uint64
+		want   int // Records.
+	}{
+		{"pay", testAccount, 1000, 1},
+		{"axfer", testAccount, 1000, 1},
+		{"keyreg", testAccount, 1000, 1},
+		{"acfg", testAccount, 1000, 1},
+		{"afrz", testAccount, 1000, 1},
+		{"appl", testAccount, 1000, 1},
+		{"appl", "OTHER", 1000, 0},
+		{"stpf", testAccount, 1000, 1},
+		{"stpf", testAccount, 0, 0},
+		{"stpf", "OTHER", 1000, 0},
+		{"hb", testAccount, 1000, 1},
+		{"hb", testAccount, 0, 0},
+		{"hb", "OTHER", 1000, 0},
+	} {
+		tx := models.Transaction{Id: "TX", Type: test.txType, Sender: test.sender, Fee: test.fee}
+		records, err := FilterTransaction(tx, "", testAccount, assetMap)
+		if err != nil {
+			t.Errorf("%s from %s: %v", test.txType, test.sender, err)
+			continue
+		}
+		if len(records) != test.want {
+			t.Errorf("%s from %s with fee %d: got %d records, want %d", test.txType, test.sender, test.fee, len(records), test.want)
+			continue
+		}
+		for _, r := range records {
+			if r.fee != test.fee || r.sentQty != test.fee {
+				t.Errorf("%s from %s: got fee %d, sent %d, want %d", test.txType, test.sender, r.fee, r.sentQty, test.fee)
+			}
+		}
+	}
+}
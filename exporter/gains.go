@@ -0,0 +1,275 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/shopspring/decimal"
+)
+
+// LotMethod selects which lots are disposed of first when calculating realized gains.
+type LotMethod string
+
+const (
+	FIFO LotMethod = "FIFO" // First in, first out.
+	LIFO LotMethod = "LIFO" // Last in, first out.
+	HIFO LotMethod = "HIFO" // Highest cost in, first out.
+)
+
+func LotMethods() []string {
+	return []string{string(FIFO), string(LIFO), string(HIFO)}
+}
+
+func ParseLotMethod(method string) (LotMethod, error) {
+	switch LotMethod(strings.ToUpper(method)) {
+	case FIFO:
+		return FIFO, nil
+	case LIFO:
+		return LIFO, nil
+	case HIFO:
+		return HIFO, nil
+	}
+	return "", fmt.Errorf("unknown lot method: %s", method)
+}
+
+// PriceSource provides the fiat price of an asset.
+type PriceSource interface {
+	// Price returns the price of one whole unit of assetID (0 for ALGO) at time t.
+	Price(assetID uint64, t time.Time) (decimal.Decimal, bool)
+}
+
+// Lot is a quantity of an asset acquired at the same time.
+type Lot struct {
+	Acquired time.Time
+	Qty      uint64          // Base units.
+	Cost     decimal.Decimal // Cost basis of Qty.
+	HasCost  bool
+	TxID     string
+}
+
+// costPerUnit is used to order lots for HIFO.
+func (l Lot) costPerUnit() decimal.Decimal {
+	if !l.HasCost || l.Qty == 0 {
+		return decimal.Zero
+	}
+	return l.Cost.Div(decimalQty(l.Qty))
+}
+
+// decimalQty converts a quantity of base units, ASA amounts can be above math.MaxInt64.
+func decimalQty(qty uint64) decimal.Decimal {
+	return decimal.NewFromBigInt(new(big.Int).SetUint64(qty), 0)
+}
+
+// Lots are the open lots of an account by asset ID, saved between runs.
+type Lots map[uint64][]Lot
+
+type realizedGain struct {
+	disposed    time.Time
+	assetID     uint64
+	qty         uint64
+	acquired    time.Time
+	hasAcquired bool
+	proceeds    decimal.Decimal
+	hasProceeds bool
+	cost        decimal.Decimal
+	hasCost     bool
+	txid        string
+}
+
+// GainsTracker matches disposals to acquired lots for the records of an account.
+type GainsTracker struct {
+	method  LotMethod
+	prices  PriceSource
+	lots    Lots
+	records []ExportRecord
+	gains   []realizedGain
+}
+
+// NewGainsTracker returns a GainsTracker continuing from the open lots of a previous run. prices can be nil.
+func NewGainsTracker(method LotMethod, prices PriceSource, lots Lots) *GainsTracker {
+	if lots == nil {
+		lots = Lots{}
+	}
+	return &GainsTracker{
+		method: method,
+		prices: prices,
+		lots:   lots,
+	}
+}
+
+// Add queues a record. Records are processed in chronological order by Process.
+func (g *GainsTracker) Add(record ExportRecord) {
+	g.records = append(g.records, record)
+}
+
+func (g *GainsTracker) Method() LotMethod {
+	return g.method
+}
+
+// Lots returns the open lots after Process.
+func (g *GainsTracker) Lots() Lots {
+	return g.lots
+}
+
+// value returns the fiat value of qty base units of assetID.
+func (g *GainsTracker) value(qty, assetID uint64, t time.Time, assetMap map[uint64]models.Asset) (decimal.Decimal, bool) {
+	if g.prices == nil {
+		return decimal.Zero, false
+	}
+	return priceValue(qty, assetID, t, g.prices, assetMap)
+}
+
+// Process calculates the realized gains of the queued records.
+func (g *GainsTracker) Process(assetMap map[uint64]models.Asset) {
+	// Acquisitions go first when records share the same time, so the lots exist for the disposal.
+	sort.SliceStable(g.records, func(i, j int) bool {
+		if !g.records[i].blockTime.Equal(g.records[j].blockTime) {
+			return g.records[i].blockTime.Before(g.records[j].blockTime)
+		}
+		return g.records[i].recvQty != 0 && g.records[j].recvQty == 0
+	})
+
+	for _, r := range g.records {
+		// Only on-chain quantities are tracked, custom currencies (e.g. BTC) have no asset ID.
+		recvValue, hasRecvValue := g.value(r.recvQty, r.recvASA, r.blockTime, assetMap)
+		sentValue, hasSentValue := g.value(r.sentQty, r.sentASA, r.blockTime, assetMap)
+		// Both sides of a trade have the same value.
+		if r.IsTrade() {
+			if !hasRecvValue && hasSentValue {
+				recvValue, hasRecvValue = sentValue, true
+			}
+			if !hasSentValue && hasRecvValue {
+				sentValue, hasSentValue = recvValue, true
+			}
+		}
+		if r.sentQty != 0 {
+			g.dispose(r, sentValue, hasSentValue)
+		}
+		if r.recvQty != 0 {
+			g.lots[r.recvASA] = append(g.lots[r.recvASA], Lot{
+				Acquired: r.blockTime,
+				Qty:      r.recvQty,
+				Cost:     recvValue,
+				HasCost:  hasRecvValue,
+				TxID:     r.txid,
+			})
+		}
+	}
+	g.records = nil
+}
+
+// nextLot returns the index of the lot to dispose of next.
+func (g *GainsTracker) nextLot(lots []Lot) int {
+	switch g.method {
+	case LIFO:
+		return len(lots) - 1
+	case HIFO:
+		next := 0
+		for i, l := range lots {
+			if l.costPerUnit().GreaterThan(lots[next].costPerUnit()) {
+				next = i
+			}
+		}
+		return next
+	}
+	return 0
+}
+
+func (g *GainsTracker) dispose(r ExportRecord, proceeds decimal.Decimal, hasProceeds bool) {
+	remaining := r.sentQty
+	lots := g.lots[r.sentASA]
+	for remaining > 0 {
+		gain := realizedGain{
+			disposed:    r.blockTime,
+			assetID:     r.sentASA,
+			hasProceeds: hasProceeds,
+			txid:        r.txid,
+		}
+		if len(lots) == 0 {
+			// Disposing of more than was acquired, the cost basis is unknown.
+			gain.qty = remaining
+		} else {
+			i := g.nextLot(lots)
+			l := lots[i]
+			gain.acquired = l.Acquired
+			gain.hasAcquired = true
+			gain.hasCost = l.HasCost
+			if l.Qty <= remaining {
+				gain.qty = l.Qty
+				gain.cost = l.Cost
+				lots = append(lots[:i], lots[i+1:]...)
+			} else {
+				gain.qty = remaining
+				gain.cost = l.Cost.Mul(decimalQty(remaining)).Div(decimalQty(l.Qty)).Round(8)
+				lots[i].Qty = l.Qty - remaining
+				lots[i].Cost = l.Cost.Sub(gain.cost)
+			}
+		}
+		if hasProceeds {
+			gain.proceeds = proceeds.Mul(decimalQty(gain.qty)).Div(decimalQty(r.sentQty)).Round(8)
+		}
+		remaining -= gain.qty
+		g.gains = append(g.gains, gain)
+	}
+	if len(lots) == 0 {
+		delete(g.lots, r.sentASA)
+	} else {
+		g.lots[r.sentASA] = lots
+	}
+}
+
+// WriteReport writes the realized gains as CSV. An *UnknownAssetError is returned if a gain is in an asset missing from assetMap.
+func (g *GainsTracker) WriteReport(out io.Writer, assetMap map[uint64]models.Asset) error {
+	// The report is formatted in full first, so nothing is written to out if an asset is unknown.
+	writer := &bytes.Buffer{}
+	f := newAssetFormatter(assetMap)
+	fmt.Fprintln(writer, "Date Sold,Currency,Asset ID,Amount,Date Acquired,Proceeds,Cost Basis,Gain,Term,Tx-ID")
+	for _, gain := range g.gains {
+		// Date Sold,Currency,Asset ID,Amount,
+		fmt.Fprintf(writer, "%s,%s,%d,%s,", gain.disposed.UTC().Format("2006-01-02T15:04:05Z"), f.currency(gain.assetID), gain.assetID, f.amount(gain.qty, gain.assetID))
+
+		// Date Acquired,
+		if gain.hasAcquired {
+			fmt.Fprintf(writer, "%s,", gain.acquired.UTC().Format("2006-01-02T15:04:05Z"))
+		} else {
+			fmt.Fprintf(writer, ",")
+		}
+
+		// Proceeds,Cost Basis,Gain,
+		var proceeds, cost, realized string
+		if gain.hasProceeds {
+			proceeds = gain.proceeds.StringFixed(2)
+		}
+		if gain.hasCost {
+			cost = gain.cost.StringFixed(2)
+		}
+		if gain.hasProceeds && gain.hasCost {
+			realized = gain.proceeds.Sub(gain.cost).StringFixed(2)
+		}
+		fmt.Fprintf(writer, "%s,%s,%s,", proceeds, cost, realized)
+
+		// Term,
+		switch {
+		case !gain.hasAcquired:
+			fmt.Fprintf(writer, ",")
+		case gain.disposed.Sub(gain.acquired) > 365*24*time.Hour:
+			fmt.Fprintf(writer, "Long,")
+		default:
+			fmt.Fprintf(writer, "Short,")
+		}
+
+		// Tx-ID
+		fmt.Fprintf(writer, "%s\n", gain.txid)
+	}
+	if f.err != nil {
+		return f.err
+	}
+	_, err := out.Write(writer.Bytes())
+	return err
+}
@@ -0,0 +1,122 @@
+package exporter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/shopspring/decimal"
+)
+
+// dailyPrices is a PriceSource with one ALGO price per day.
+type dailyPrices map[string]string
+
+func (p dailyPrices) Price(assetID uint64, t time.Time) (decimal.Decimal, bool) {
+	price, ok := p[t.Format("2006-01-02")]
+	if !ok || assetID != 0 {
+		return decimal.Zero, false
+	}
+	return decimal.RequireFromString(price), true
+}
+
+func TestGainsTrackerLotMethods(t *testing.T) {
+	account := "HFTA36U4OCTSMXRUH4ZX3OACJBTJCR56AIH3G345TRPUQJHJBEXKLMMO4E"
+	day := func(d int) time.Time { return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC) }
+	prices := dailyPrices{"2021-01-01": "1", "2021-01-02": "3", "2021-01-03": "2", "2021-01-04": "4"}
+
+	// Records are added newest first, as they are exported.
+	records := []ExportRecord{
+		{blockTime: day(4), txid: "SELL", sentQty: 1500000, account: account},
+		{blockTime: day(3), txid: "BUY3", recvQty: 1000000, account: account},
+		{blockTime: day(2), txid: "BUY2", recvQty: 1000000, account: account},
+		{blockTime: day(1), txid: "BUY1", recvQty: 1000000, account: account},
+	}
+
+	tests := []struct {
+		method LotMethod
+		want   []string
+	}{
+		{FIFO, []string{
+			"2021-01-04T00:00:00Z,ALGO,0,1.000000,2021-01-01T00:00:00Z,4.00,1.00,3.00,Short,SELL",
+			"2021-01-04T00:00:00Z,ALGO,0,0.500000,2021-01-02T00:00:00Z,2.00,1.50,0.50,Short,SELL",
+		}},
+		{LIFO, []string{
+			"2021-01-04T00:00:00Z,ALGO,0,1.000000,2021-01-03T00:00:00Z,4.00,2.00,2.00,Short,SELL",
+			"2021-01-04T00:00:00Z,ALGO,0,0.500000,2021-01-02T00:00:00Z,2.00,1.50,0.50,Short,SELL",
+		}},
+		{HIFO, []string{
+			"2021-01-04T00:00:00Z,ALGO,0,1.000000,2021-01-02T00:00:00Z,4.00,3.00,1.00,Short,SELL",
+			"2021-01-04T00:00:00Z,ALGO,0,0.500000,2021-01-03T00:00:00Z,2.00,1.00,1.00,Short,SELL",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.method), func(t *testing.T) {
+			gains := NewGainsTracker(test.method, prices, nil)
+			for _, r := range records {
+				gains.Add(r)
+			}
+			gains.Process(map[uint64]models.Asset{})
+
+			var out bytes.Buffer
+			if err := gains.WriteReport(&out, map[uint64]models.Asset{}); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+
+			var open uint64
+			for _, lot := range gains.Lots()[0] {
+				open += lot.Qty
+			}
+			if open != 1500000 {
+				t.Errorf("open lots: got %d, want 1500000", open)
+			}
+		})
+	}
+}
+
+func TestGainsTrackerLargeQuantities(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC) }
+	prices := dailyPrices{"2021-01-01": "1", "2021-01-02": "3"}
+	const maxQty = ^uint64(0) // Above math.MaxInt64, a valid ASA amount.
+
+	gains := NewGainsTracker(FIFO, prices, nil)
+	gains.Add(ExportRecord{blockTime: day(2), txid: "SELL", sentQty: maxQty / 2})
+	gains.Add(ExportRecord{blockTime: day(1), txid: "BUY", recvQty: maxQty})
+	gains.Process(map[uint64]models.Asset{})
+
+	if len(gains.gains) != 1 {
+		t.Fatalf("got %d gains, want 1", len(gains.gains))
+	}
+	gain := gains.gains[0]
+	// Half of the lot bought at 1 and sold at 3.
+	wantCost := decimal.RequireFromString("9223372036854.775807")
+	if gain.cost.Sub(wantCost).Abs().GreaterThan(decimal.RequireFromString("0.01")) || !gain.proceeds.IsPositive() {
+		t.Errorf("got cost %s, proceeds %s, want cost %s", gain.cost, gain.proceeds, wantCost)
+	}
+	if lot := gains.Lots()[0][0]; lot.Qty != maxQty-maxQty/2 || !lot.Cost.IsPositive() {
+		t.Errorf("open lot: got %+v", lot)
+	}
+}
+
+func TestGainsTrackerReportUnknownAsset(t *testing.T) {
+	account := "HFTA36U4OCTSMXRUH4ZX3OACJBTJCR56AIH3G345TRPUQJHJBEXKLMMO4E"
+	blockTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	gains := NewGainsTracker(FIFO, dailyPrices{}, nil)
+	gains.Add(ExportRecord{blockTime: blockTime.Add(time.Hour), txid: "SELL", sentQty: 10, sentASA: 42, account: account})
+	gains.Add(ExportRecord{blockTime: blockTime, txid: "BUY", recvQty: 10, recvASA: 42, account: account})
+	gains.Process(map[uint64]models.Asset{})
+
+	var out bytes.Buffer
+	err := gains.WriteReport(&out, map[uint64]models.Asset{})
+	if _, ok := err.(*UnknownAssetError); !ok {
+		t.Errorf("got error %v, want an *UnknownAssetError", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("got a partial report:\n%s", out.String())
+	}
+}
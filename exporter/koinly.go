@@ -0,0 +1,173 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func init() {
+	registerFormat("koinly", NewkoinlyExporter)
+}
+
+type koinlyExporter struct {
+}
+
+func NewkoinlyExporter() Interface {
+	return &koinlyExporter{}
+}
+
+func (k koinlyExporter) Name() string {
+	return "koinly"
+}
+
+func (k *koinlyExporter) WriteHeader(writer io.Writer) {
+	// https://help.koinly.io/en/articles/3662999-how-to-create-a-custom-csv-file-with-your-data
+	// Koinly Universal Format.
+	fmt.Fprintln(writer, "Date,Sent Amount,Sent Currency,Received Amount,Received Currency,Fee Amount,Fee Currency,Net Worth Amount,Net Worth Currency,Label,Description,TxHash")
+}
+
+// koinlyCurrency returns the currency name of an asset for Koinly.
+// Verified ASA use the same names as the other formats, everything else is
+// disambiguated with the asset ID since Koinly matches coins by symbol.
+func koinlyCurrency(assetID uint64, f *assetFormatter) string {
+	if assetID == 0 {
+		return "ALGO"
+	}
+	if _, ok := verifiedASA[assetID]; ok {
+		return f.currency(assetID)
+	}
+	unitName := strings.NewReplacer(",", "", "\"", "", " ", "").Replace(f.unitName(assetID))
+	if unitName == "" {
+		return fmt.Sprintf("ASA-%d", assetID)
+	}
+	return fmt.Sprintf("%s-%d", unitName, assetID)
+}
+
+// koinlyLabel maps the ExportRecord type to a Koinly transaction label.
+// https://help.koinly.io/en/articles/3663453-what-are-tags-labels
+func koinlyLabel(record ExportRecord) string {
+	switch {
+	case record.airdrop:
+		return "airdrop"
+	case record.borrow:
+		return "loan fee"
+	case record.expenseNoTax:
+		return "loan repayment"
+	case record.feeTx || record.otherFee:
+		return "cost"
+	case record.incomeNoTax:
+		return "loan"
+	case record.lending:
+		return "lending interest"
+	case record.mining:
+		return "mining"
+	case record.reward:
+		return "reward"
+	case record.staking:
+		return "staking"
+	}
+	// Trades, deposits, withdrawals and spends use Koinly's default handling.
+	return ""
+}
+
+// koinlyTxHash returns the on-chain ID of the record's transaction, so Koinly can link to it.
+// Inner transactions have no ID of their own and use the ID of their top level transaction.
+func koinlyTxHash(record ExportRecord) string {
+	if record.txid != "" {
+		return record.txid
+	}
+	if i := strings.LastIndex(record.topTxID, "inner-"); i >= 0 {
+		return record.topTxID[i+len("inner-"):]
+	}
+	return record.topTxID
+}
+
+func (k *koinlyExporter) WriteRecord(out io.Writer, assetMap map[uint64]models.Asset, record ExportRecord) error {
+	// The record is formatted in full first, so nothing is written to out if an asset is unknown.
+	writer := &bytes.Buffer{}
+	f := newAssetFormatter(assetMap)
+
+	// Date,Sent Amount,Sent Currency,Received Amount,Received Currency,Fee Amount,Fee Currency,Net Worth Amount,Net Worth Currency,Label,Description,TxHash
+
+	// Fee transactions are exported as a cost, so the fee is not deducted twice.
+	isFee := record.feeTx || record.otherFee
+
+	// Koinly deducts the fee in addition to the sent amount, whereas ALGO sends
+	// include the transaction fee in sentQty.
+	sentQty := record.sentQty
+	if !isFee && record.sentASA == 0 && record.fee != 0 && sentQty > record.fee {
+		sentQty = sentQty - record.fee
+	}
+
+	// Date,
+	fmt.Fprintf(writer, "%s UTC,", record.blockTime.UTC().Format("2006-01-02 15:04:05"))
+
+	// Sent Amount,Sent Currency,
+	switch {
+	case record.sentCustomQty != "" && record.sentCustomCurrency != "":
+		fmt.Fprintf(writer, "%s,%s,", record.sentCustomQty, record.sentCustomCurrency)
+	case sentQty != 0:
+		fmt.Fprintf(writer, "%s,%s,", f.amount(sentQty, record.sentASA), koinlyCurrency(record.sentASA, f))
+	default:
+		fmt.Fprintf(writer, ",,")
+	}
+	// Received Amount,Received Currency,
+	switch {
+	case record.recvCustomQty != "" && record.recvCustomCurrency != "":
+		fmt.Fprintf(writer, "%s,%s,", record.recvCustomQty, record.recvCustomCurrency)
+	case record.recvQty != 0:
+		fmt.Fprintf(writer, "%s,%s,", f.amount(record.recvQty, record.recvASA), koinlyCurrency(record.recvASA, f))
+	default:
+		fmt.Fprintf(writer, ",,")
+	}
+	// Fee Amount,Fee Currency,
+	switch {
+	case isFee:
+		fmt.Fprintf(writer, ",,")
+	case record.feeCustom != "" && record.feeCustomCurrency != "":
+		fmt.Fprintf(writer, "%s,%s,", record.feeCustom, record.feeCustomCurrency)
+	case record.fee != 0 && sentQty != record.sentQty:
+		fmt.Fprintf(writer, "%s,ALGO,", algoFmt(record.fee))
+	default:
+		fmt.Fprintf(writer, ",,")
+	}
+
+	// Net Worth Amount,Net Worth Currency,
+	switch {
+	case record.recvValue != "":
+		fmt.Fprintf(writer, "%s,%s,", record.recvValue, record.valueCurrency)
+	case record.sentValue != "":
+		fmt.Fprintf(writer, "%s,%s,", record.sentValue, record.valueCurrency)
+	default:
+		fmt.Fprintf(writer, ",,")
+	}
+
+	// Label,
+	fmt.Fprintf(writer, "%s,", koinlyLabel(record))
+
+	// Description,
+	var comments []string
+	if comment := f.comment(record.recvASA); comment != "" {
+		comments = append(comments, comment)
+	}
+	if comment := f.comment(record.sentASA); comment != "" && record.recvASA != record.sentASA {
+		comments = append(comments, comment)
+	}
+	if record.comment != "" {
+		comments = append(comments, record.comment)
+	}
+	fmt.Fprintf(writer, "%q,", strings.Join(comments, " | "))
+
+	// TxHash
+	fmt.Fprint(writer, koinlyTxHash(record))
+	fmt.Fprint(writer, "\n")
+	if f.err != nil {
+		return f.err
+	}
+	_, err := out.Write(writer.Bytes())
+	return err
+}
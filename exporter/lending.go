@@ -0,0 +1,93 @@
+package exporter
+
+import (
+	"fmt"
+)
+
+// LendingState is the supplied and borrowed amounts of each market of a lending protocol, keyed by lendingMarketKey.
+// Lending handlers need the amounts from all previous transactions to split out interest.
+// https://cointracking.freshdesk.com/en/support/solutions/articles/29000033408-loans-and-their-repayments
+type LendingState struct {
+	Markets map[string]*LendingMarket `json:",omitempty"`
+}
+
+// LendingMarket is the balance of an asset in a lending market application.
+type LendingMarket struct {
+	AppID   uint64
+	AssetID uint64
+	Supply  uint64
+	Borrow  uint64
+}
+
+func lendingMarketKey(appID, assetID uint64) string {
+	return fmt.Sprintf("%d-%d", appID, assetID)
+}
+
+// market returns the balance of assetID in the market application appID, creating it on first use.
+func (s *LendingState) market(appID, assetID uint64) *LendingMarket {
+	if s.Markets == nil {
+		s.Markets = map[string]*LendingMarket{}
+	}
+	key := lendingMarketKey(appID, assetID)
+	m, ok := s.Markets[key]
+	if !ok {
+		m = &LendingMarket{AppID: appID, AssetID: assetID}
+		s.Markets[key] = m
+	}
+	return m
+}
+
+// supply adds the amount r sends to the market appID.
+func (s *LendingState) supply(appID uint64, r ExportRecord) {
+	s.market(appID, r.sentASA).Supply += lendingSent(r)
+}
+
+// redeem removes the amount r receives from the market appID. The amount above the supplied amount is
+// returned as a separate lending income record.
+func (s *LendingState) redeem(appID uint64, r ExportRecord, protocol string) (ExportRecord, *ExportRecord) {
+	market := s.market(appID, r.recvASA)
+	if r.recvQty <= market.Supply {
+		market.Supply = market.Supply - r.recvQty
+		return r, nil
+	}
+	interest := r
+	interest.recvQty = r.recvQty - market.Supply
+	interest.lending = true
+	interest.comment = protocol + " - Withdraw - Lending Income"
+	r.recvQty = market.Supply
+	market.Supply = 0
+	return r, &interest
+}
+
+// borrow adds the amount r receives to the borrowed amount of the market appID.
+func (s *LendingState) borrow(appID uint64, r ExportRecord) {
+	s.market(appID, r.recvASA).Borrow += r.recvQty
+}
+
+// repay removes the amount r sends from the borrowed amount of the market appID. The amount above the
+// borrowed amount is returned as a separate borrowing fee record.
+func (s *LendingState) repay(appID uint64, r ExportRecord, protocol string) (ExportRecord, *ExportRecord) {
+	market := s.market(appID, r.sentASA)
+	repaid := lendingSent(r)
+	if repaid <= market.Borrow {
+		market.Borrow = market.Borrow - repaid
+		return r, nil
+	}
+	// The fee of an ALGO repayment stays with the repayment.
+	borrowFee := r
+	borrowFee.sentQty = repaid - market.Borrow
+	borrowFee.fee = 0
+	borrowFee.borrow = true
+	borrowFee.comment = protocol + " - Repay - Borrowing Fee"
+	r.sentQty = r.sentQty - borrowFee.sentQty
+	market.Borrow = 0
+	return r, &borrowFee
+}
+
+// lendingSent is the amount sent to a market by r, without the fee included in ALGO amounts.
+func lendingSent(r ExportRecord) uint64 {
+	if r.sentASA == 0 {
+		return r.sentQty - r.fee
+	}
+	return r.sentQty
+}
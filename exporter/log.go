@@ -0,0 +1,144 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(level), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, valid levels are: %s", name, strings.Join(levelNames, ", "))
+}
+
+// Logger writes leveled messages with key/value fields, as text or JSON lines.
+// A nil *Logger discards every message.
+type Logger struct {
+	out    *logOutput
+	fields []interface{} // Key/value pairs added by With.
+}
+
+// logOutput is shared by a Logger and every Logger derived from it with With.
+type logOutput struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	json  bool
+	now   func() time.Time
+}
+
+// NewLogger returns a Logger writing messages of level and above to w, as JSON lines if json is true.
+func NewLogger(w io.Writer, level Level, json bool) *Logger {
+	return &Logger{out: &logOutput{w: w, level: level, json: json, now: time.Now}}
+}
+
+// With returns a Logger adding the key/value pairs to every message, e.g. log.With("account", account).
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+	return &Logger{out: l.out, fields: fields}
+}
+
+// Enabled reports whether messages of level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.out.level
+}
+
+func (l *Logger) Debug(msg string, keyValues ...interface{}) { l.log(LevelDebug, msg, keyValues) }
+func (l *Logger) Info(msg string, keyValues ...interface{})  { l.log(LevelInfo, msg, keyValues) }
+func (l *Logger) Warn(msg string, keyValues ...interface{})  { l.log(LevelWarn, msg, keyValues) }
+func (l *Logger) Error(msg string, keyValues ...interface{}) { l.log(LevelError, msg, keyValues) }
+
+func (l *Logger) log(level Level, msg string, keyValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := append(append([]interface{}{}, l.fields...), keyValues...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(missing)")
+	}
+
+	var line bytes.Buffer
+	now := l.out.now().UTC().Format(time.RFC3339)
+	if l.out.json {
+		line.WriteString(`{"time":`)
+		writeJSONValue(&line, now)
+		line.WriteString(`,"level":`)
+		writeJSONValue(&line, level.String())
+		line.WriteString(`,"msg":`)
+		writeJSONValue(&line, msg)
+		for i := 0; i < len(fields); i += 2 {
+			line.WriteByte(',')
+			writeJSONValue(&line, fmt.Sprint(fields[i]))
+			line.WriteByte(':')
+			writeJSONValue(&line, fields[i+1])
+		}
+		line.WriteString("}\n")
+	} else {
+		fmt.Fprintf(&line, "%s %-5s %s", now, strings.ToUpper(level.String()), msg)
+		for i := 0; i < len(fields); i += 2 {
+			fmt.Fprintf(&line, " %v=%s", fields[i], textValue(fields[i+1]))
+		}
+		line.WriteByte('\n')
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(line.Bytes())
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	switch value := v.(type) {
+	case error:
+		v = value.Error()
+	case fmt.Stringer:
+		v = value.String()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+// textValue formats a field value, quoting it if it contains spaces or quotes.
+func textValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
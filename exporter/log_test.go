@@ -0,0 +1,54 @@
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLogger(level Level, json bool) (*Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+	log := NewLogger(&out, level, json)
+	log.out.now = func() time.Time { return time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return log, &out
+}
+
+func TestLogger(t *testing.T) {
+	log, out := newTestLogger(LevelInfo, false)
+	log = log.With("account", "ACCOUNT")
+	log.Debug("hidden")
+	log.With("app", 465814065).Info("processing group", "group", "a b", "error", errors.New("failed"))
+	log.Warn("odd", "key")
+	want := `2022-01-02T03:04:05Z INFO  processing group account=ACCOUNT app=465814065 group="a b" error=failed
+2022-01-02T03:04:05Z WARN  odd account=ACCOUNT key=(missing)
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	log, out = newTestLogger(LevelWarn, true)
+	log.Info("hidden")
+	log.With("txid", "TX").Error("failed", "error", errors.New("HTTP 500"), "round", 5)
+	want = `{"time":"2022-01-02T03:04:05Z","level":"error","msg":"failed","txid":"TX","error":"HTTP 500","round":5}
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// A nil logger discards every message.
+	var discard *Logger
+	discard.With("account", "ACCOUNT").Error("discarded")
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "warn": LevelWarn, "error": LevelError} {
+		level, err := ParseLevel(name)
+		if err != nil || level != want {
+			t.Errorf("%s: got %v, %v", name, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
@@ -0,0 +1,122 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+// NormalizeRecords classifies the records of a transaction group (e.g. trades, staking, airdrops).
+// records are the FilterTransaction records of txns, including inner transactions.
+// The user defined rules, if any, classify the groups no application handler exports, before the built-in rules.
+// The returned bool is true when the group must be processed later with NormalizeDeferred.
+func NormalizeRecords(log *Logger, records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset, state ApplState, rules *Rules) ([]ExportRecord, bool, error) {
+	// Applications (e.g. DeFi, Liquidity Pool) are usually part of a Group transaction.
+	if IsApplGroup(txns) {
+		processed, handled, deferred, err := normalizeApplication(log, records, txns, assetMap, state)
+		if handled || err != nil {
+			return processed, deferred, err
+		}
+	}
+
+	records, matched, err := rules.Apply(records, txns, assetMap)
+	if err != nil || matched {
+		return records, false, err
+	}
+
+	// Assume Mining transactions are usually done in 1 ASA deposit transaction.
+	if IsLengthExcludeReward(records, 1) && records[0].IsASADeposit() {
+		r := records[0]
+		switch {
+		case r.IsAssetIDDeposit(27165954):
+			records, err := MiningPlanets(records)
+			return records, false, err
+		}
+	}
+
+	// Other Rewards.
+	if IsLengthExcludeReward(records, 1) && records[0].IsDeposit() {
+		r := records[0]
+		switch {
+		case r.IsAlgorandGovernance():
+			records, err := RewardsAlgorandGovernance(records)
+			return records, false, err
+		case r.IsAlgoStake():
+			records, err := RewardsAlgoStake(records)
+			return records, false, err
+		}
+	}
+
+	// Other dApps.
+	if (IsLengthExcludeReward(records, 1) && records[0].IsASADeposit()) || (IsLengthExcludeReward(records, 2) && records[0].IsASAWithdrawal()) {
+		r := records[0]
+		switch {
+		case r.IsAlgomint():
+			records, err := DAppAlgomint(records, assetMap)
+			return records, false, err
+		}
+	}
+
+	// ASA Airdrops/Rewards are usually done in 1 ASA deposit transaction.
+	if IsLengthExcludeReward(records, 1) && records[0].IsASADeposit() {
+		var err error
+		records, err = AirdropASA(records)
+		if err != nil {
+			return records, false, err
+		}
+	}
+
+	// Airdrops/Rewards are usually done in 1 ALGO deposit transaction.
+	if IsLengthExcludeReward(records, 1) && records[0].IsALGODeposit() {
+		var err error
+		records, err = AirdropALGO(records)
+		if err != nil {
+			return records, false, err
+		}
+	}
+
+	return markUnclassified(records, txns), false, nil
+}
+
+// markUnclassified marks the records of a group none of the rules above could interpret:
+// funds moved by an application without a handler, or a deposit no airdrop or reward rule matched.
+// Fees and rewards alone are always classified, and so is a group any rule above classified, e.g. an airdrop
+// sent by an application.
+func markUnclassified(records []ExportRecord, txns []models.Transaction) []ExportRecord {
+	for _, r := range records {
+		if !r.feeTx && !r.reward && r.classified() {
+			return records
+		}
+	}
+	var reason string
+	for _, tx := range txns {
+		if tx.Type == "appl" {
+			reason = fmt.Sprintf("no handler for application ID %d", tx.ApplicationTransaction.ApplicationId)
+			break
+		}
+	}
+	if reason == "" {
+		if !IsLengthExcludeReward(records, 1) || !records[0].IsDeposit() || records[0].comment != "" {
+			return records
+		}
+		reason = "deposit not matched by the airdrop and reward rules"
+	}
+	return unclassifiedRecords(records, reason)
+}
+
+// unclassifiedRecords marks the records of a group for the unclassified report with reason, e.g. for a group of
+// an application handler which does not recognise it. Fees and rewards are left out.
+func unclassifiedRecords(records []ExportRecord, reason string) []ExportRecord {
+	for i, r := range records {
+		if !r.feeTx && !r.reward {
+			records[i].unclassified = reason
+		}
+	}
+	return records
+}
+
+// classified reports whether a rule gave the record a type or a comment.
+func (r ExportRecord) classified() bool {
+	return r.comment != "" || r.airdrop || r.borrow || r.expenseNoTax || r.mining || r.incomeNoTax || r.lending ||
+		r.otherFee || r.spend || r.staking || r.trade
+}
@@ -0,0 +1,202 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/shopspring/decimal"
+)
+
+const priceDateFormat = "2006-01-02"
+
+// FilePrices is a PriceSource of daily prices loaded from a local file.
+type FilePrices struct {
+	prices map[uint64]map[string]decimal.Decimal
+}
+
+// LoadPriceFile loads daily prices by asset ID (0 for ALGO) from a CSV or JSON file.
+// CSV files have one "asset id,date,price" row per day, with an optional header:
+//
+//	0,2021-01-01,0.85
+//
+// JSON files map asset IDs to dates to prices:
+//
+//	{"0": {"2021-01-01": "0.85"}}
+//
+// Dates are UTC days in YYYY-MM-DD format.
+func LoadPriceFile(file string) (*FilePrices, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &FilePrices{prices: map[uint64]map[string]decimal.Decimal{}}
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		err = p.loadJSON(f)
+	} else {
+		err = p.loadCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading prices from %s: %w", file, err)
+	}
+	return p, nil
+}
+
+func (p *FilePrices) add(assetID, date, price string) error {
+	id, err := strconv.ParseUint(strings.TrimSpace(assetID), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid asset id %q: %w", assetID, err)
+	}
+	day, err := time.Parse(priceDateFormat, strings.TrimSpace(date))
+	if err != nil {
+		return fmt.Errorf("invalid date %q: %w", date, err)
+	}
+	value, err := decimal.NewFromString(strings.TrimSpace(price))
+	if err != nil {
+		return fmt.Errorf("invalid price %q: %w", price, err)
+	}
+	if _, ok := p.prices[id]; !ok {
+		p.prices[id] = map[string]decimal.Decimal{}
+	}
+	p.prices[id][day.Format(priceDateFormat)] = value
+	return nil
+}
+
+func (p *FilePrices) loadCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.Comment = '#'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		// Skip the header.
+		if i == 0 {
+			if _, err := strconv.ParseUint(strings.TrimSpace(row[0]), 10, 64); err != nil {
+				continue
+			}
+		}
+		if err := p.add(row[0], row[1], row[2]); err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (p *FilePrices) loadJSON(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var prices map[string]map[string]json.Number
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return err
+	}
+	for assetID, days := range prices {
+		for date, price := range days {
+			if err := p.add(assetID, date, price.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *FilePrices) Price(assetID uint64, t time.Time) (decimal.Decimal, bool) {
+	price, ok := p.prices[assetID][t.UTC().Format(priceDateFormat)]
+	return price, ok
+}
+
+// MissingPrices collects the days an asset had no price.
+type MissingPrices map[uint64]map[string]bool
+
+func (m MissingPrices) add(assetID uint64, t time.Time) {
+	if _, ok := m[assetID]; !ok {
+		m[assetID] = map[string]bool{}
+	}
+	m[assetID][t.UTC().Format(priceDateFormat)] = true
+}
+
+// Log warns once per asset with the number of days and the date range of the missing prices.
+func (m MissingPrices) Log(log *Logger, assetMap map[uint64]models.Asset) {
+	var assetIDs []uint64
+	for assetID := range m {
+		assetIDs = append(assetIDs, assetID)
+	}
+	sort.Slice(assetIDs, func(i, j int) bool { return assetIDs[i] < assetIDs[j] })
+
+	for _, assetID := range assetIDs {
+		var days []string
+		for day := range m[assetID] {
+			days = append(days, day)
+		}
+		sort.Strings(days)
+		unitName, _ := asaUnitName(assetID, assetMap) // Left empty for an unknown asset.
+		log.Warn("missing prices", "asset", assetID, "unit", unitName, "days", len(days), "from", days[0], "to", days[len(days)-1])
+	}
+}
+
+// priceValue returns the value of qty base units of assetID at time t.
+func priceValue(qty, assetID uint64, t time.Time, prices PriceSource, assetMap map[uint64]models.Asset) (decimal.Decimal, bool) {
+	if qty == 0 {
+		return decimal.Zero, false
+	}
+	price, ok := prices.Price(assetID, t)
+	if !ok {
+		return decimal.Zero, false
+	}
+	formatted, err := assetIDFmt(qty, assetID, assetMap)
+	if err != nil {
+		return decimal.Zero, false
+	}
+	amount, err := decimal.NewFromString(formatted)
+	if err != nil {
+		return decimal.Zero, false
+	}
+	return amount.Mul(price), true
+}
+
+// PriceRecords sets the received and sent value of the records in currency.
+// Both sides of a trade have the same value, so a trade only needs the price of one asset.
+func PriceRecords(records []ExportRecord, prices PriceSource, currency string, assetMap map[uint64]models.Asset, missing MissingPrices) []ExportRecord {
+	for i, r := range records {
+		recvValue, hasRecvValue := priceValue(r.recvQty, r.recvASA, r.blockTime, prices, assetMap)
+		sentValue, hasSentValue := priceValue(r.sentQty, r.sentASA, r.blockTime, prices, assetMap)
+		if r.IsTrade() {
+			if !hasRecvValue && hasSentValue {
+				recvValue, hasRecvValue = sentValue, true
+			}
+			if !hasSentValue && hasRecvValue {
+				sentValue, hasSentValue = recvValue, true
+			}
+		}
+		// Only report prices which are still missing after using the other side of a trade.
+		if missing != nil && r.recvQty != 0 && !hasRecvValue {
+			missing.add(r.recvASA, r.blockTime)
+		}
+		if missing != nil && r.sentQty != 0 && !hasSentValue {
+			missing.add(r.sentASA, r.blockTime)
+		}
+
+		if hasRecvValue {
+			records[i].recvValue = recvValue.StringFixed(2)
+		}
+		if hasSentValue {
+			records[i].sentValue = sentValue.StringFixed(2)
+		}
+		records[i].valueCurrency = currency
+	}
+	return records
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func TestPriceRecords(t *testing.T) {
+	prices, err := LoadPriceFile(filepath.Join("testdata", "prices.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockTime := time.Date(2021, 12, 20, 11, 33, 20, 0, time.UTC)
+	assetMap := map[uint64]models.Asset{
+		31566704: {Index: 31566704, Params: models.AssetParams{UnitName: "USDC", Decimals: 6}},
+	}
+	records := []ExportRecord{
+		// ALGO -> USDC trade, the USDC value comes from the ALGO side.
+		{blockTime: blockTime, recvQty: 15000000, recvASA: 31566704, sentQty: 10000000},
+		// USDC deposit without a price.
+		{blockTime: blockTime, recvQty: 1000000, recvASA: 31566704},
+	}
+	missing := MissingPrices{}
+	records = PriceRecords(records, prices, "USD", assetMap, missing)
+
+	if records[0].recvValue != "15.00" || records[0].sentValue != "15.00" {
+		t.Errorf("trade values: got %q/%q, want 15.00/15.00", records[0].recvValue, records[0].sentValue)
+	}
+	if records[1].recvValue != "" {
+		t.Errorf("deposit value: got %q, want none", records[1].recvValue)
+	}
+	if len(missing) != 1 || !missing[31566704]["2021-12-20"] {
+		t.Errorf("missing prices: got %v, want USDC on 2021-12-20", missing)
+	}
+
+	log, out := newTestLogger(LevelWarn, false)
+	missing.add(31566704, blockTime.AddDate(0, 0, 2))
+	missing.Log(log, assetMap)
+	want := "2022-01-02T03:04:05Z WARN  missing prices asset=31566704 unit=USDC days=2 from=2021-12-20 to=2021-12-22\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
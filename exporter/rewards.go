@@ -45,7 +45,6 @@ func RewardsAlgorandGovernance(records []ExportRecord) ([]ExportRecord, error) {
 	note := base64.StdEncoding.EncodeToString(r.txRaw.Note)
 	decoded, err := base64.StdEncoding.DecodeString(note)
 	if err != nil {
-		fmt.Println("decode error:", err)
 		return records, err
 	}
 
@@ -0,0 +1,186 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/shopspring/decimal"
+)
+
+// ruleTypes sets the record type of a rule.
+var ruleTypes = map[string]func(r *ExportRecord){
+	"airdrop":             func(r *ExportRecord) { r.airdrop = true },
+	"borrow-fee":          func(r *ExportRecord) { r.borrow = true },
+	"expense-non-taxable": func(r *ExportRecord) { r.expenseNoTax = true },
+	"fee":                 func(r *ExportRecord) { r.otherFee = true },
+	"income":              func(r *ExportRecord) { r.reward = true },
+	"income-non-taxable":  func(r *ExportRecord) { r.incomeNoTax = true },
+	"lending":             func(r *ExportRecord) { r.lending = true },
+	"mining":              func(r *ExportRecord) { r.mining = true },
+	"reward":              func(r *ExportRecord) { r.reward = true },
+	"spend":               func(r *ExportRecord) { r.spend = true },
+	"staking":             func(r *ExportRecord) { r.staking = true },
+	"transfer":            func(r *ExportRecord) {}, // A plain deposit or withdrawal, e.g. between own accounts.
+}
+
+// Rule classifies the records it matches. Every condition set must match.
+type Rule struct {
+	Name       string  `json:"name"`
+	Sender     string  `json:"sender,omitempty"`
+	Receiver   string  `json:"receiver,omitempty"`
+	AssetID    *uint64 `json:"assetId,omitempty"` // 0 for ALGO.
+	AppID      uint64  `json:"appId,omitempty"`   // An application called by the transaction group.
+	NotePrefix string  `json:"notePrefix,omitempty"`
+	NoteRegex  string  `json:"noteRegex,omitempty"`
+	MinAmount  string  `json:"minAmount,omitempty"` // Inclusive, in asset units, e.g. "0.5".
+	MaxAmount  string  `json:"maxAmount,omitempty"` // Inclusive, in asset units.
+	Type       string  `json:"type"`
+	Comment    string  `json:"comment,omitempty"`
+
+	noteRegex *regexp.Regexp
+	minAmount *decimal.Decimal
+	maxAmount *decimal.Decimal
+}
+
+// Rules are user defined classification rules, evaluated in order before the built-in rules, for the groups
+// no application handler exports.
+type Rules struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// LoadRules loads a JSON rules file, e.g.:
+//
+//	{"rules": [
+//	  {"name": "Project payouts", "sender": "<address>", "assetId": 123, "type": "staking", "comment": "Project staking"},
+//	  {"name": "Faucet", "noteRegex": "^faucet", "maxAmount": "1", "type": "airdrop"}
+//	]}
+func LoadRules(file string) (*Rules, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rules file %s: %w", file, err)
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("unable to parse rules file %s: %w", file, err)
+	}
+	for i, rule := range rules.Rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("rules file %s, rule %d %q: %w", file, i+1, rule.Name, err)
+		}
+	}
+	return &rules, nil
+}
+
+func (rule *Rule) compile() error {
+	if _, ok := ruleTypes[rule.Type]; !ok {
+		var types []string
+		for ruleType := range ruleTypes {
+			types = append(types, ruleType)
+		}
+		sort.Strings(types)
+		return fmt.Errorf("unknown type %q, valid types are: %s", rule.Type, strings.Join(types, ", "))
+	}
+	if rule.Sender == "" && rule.Receiver == "" && rule.AssetID == nil && rule.AppID == 0 &&
+		rule.NotePrefix == "" && rule.NoteRegex == "" && rule.MinAmount == "" && rule.MaxAmount == "" {
+		return fmt.Errorf("no conditions, the rule would match every record")
+	}
+	if rule.NoteRegex != "" {
+		re, err := regexp.Compile(rule.NoteRegex)
+		if err != nil {
+			return fmt.Errorf("invalid noteRegex: %w", err)
+		}
+		rule.noteRegex = re
+	}
+	for _, amount := range []struct {
+		value  string
+		parsed **decimal.Decimal
+	}{{rule.MinAmount, &rule.minAmount}, {rule.MaxAmount, &rule.maxAmount}} {
+		if amount.value == "" {
+			continue
+		}
+		d, err := decimal.NewFromString(amount.value)
+		if err != nil {
+			return fmt.Errorf("invalid amount %q: %w", amount.value, err)
+		}
+		*amount.parsed = &d
+	}
+	return nil
+}
+
+// match reports whether the rule matches the record r of the transaction group txns.
+func (rule *Rule) match(r ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset) (bool, error) {
+	// The amount and asset of a record are what it receives, or what it sends.
+	qty, assetID := r.recvQty, r.recvASA
+	if qty == 0 {
+		qty, assetID = r.sentQty, r.sentASA
+	}
+	note := string(r.txRaw.Note)
+	switch {
+	case rule.Sender != "" && r.sender != rule.Sender:
+		return false, nil
+	case rule.Receiver != "" && r.receiver != rule.Receiver:
+		return false, nil
+	case rule.AssetID != nil && assetID != *rule.AssetID:
+		return false, nil
+	case rule.AppID != 0 && !callsApplication(txns, rule.AppID):
+		return false, nil
+	case rule.NotePrefix != "" && !strings.HasPrefix(note, rule.NotePrefix):
+		return false, nil
+	case rule.noteRegex != nil && !rule.noteRegex.MatchString(note):
+		return false, nil
+	}
+	if rule.minAmount == nil && rule.maxAmount == nil {
+		return true, nil
+	}
+	formatted, err := assetIDFmt(qty, assetID, assetMap)
+	if err != nil {
+		return false, err
+	}
+	amount, err := decimal.NewFromString(formatted)
+	if err != nil {
+		return false, err
+	}
+	if rule.minAmount != nil && amount.LessThan(*rule.minAmount) {
+		return false, nil
+	}
+	if rule.maxAmount != nil && amount.GreaterThan(*rule.maxAmount) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Apply classifies the FilterTransaction records of the transaction group txns with the first matching
+// rule of each record, fees and rewards excepted. matched is true if any record matched, in which case
+// the group is not classified by the built-in rules. A nil *Rules matches nothing.
+func (rules *Rules) Apply(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset) (processed []ExportRecord, matched bool, err error) {
+	if rules == nil {
+		return records, false, nil
+	}
+	for i, r := range records {
+		if r.feeTx || r.reward {
+			continue
+		}
+		for _, rule := range rules.Rules {
+			ok, err := rule.match(r, txns, assetMap)
+			if err != nil {
+				return records, false, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+			if !ok {
+				continue
+			}
+			ruleTypes[rule.Type](&records[i])
+			records[i].comment = rule.Comment
+			if records[i].comment == "" {
+				records[i].comment = rule.Name
+			}
+			matched = true
+			break
+		}
+	}
+	return records, matched, nil
+}
@@ -0,0 +1,158 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func TestRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.json")
+	err := ioutil.WriteFile(file, []byte(`{"rules": [
+		{"name": "Project payouts", "sender": "PROJECT", "assetId": 0, "type": "staking", "comment": "Project staking"},
+		{"name": "Faucet", "noteRegex": "^faucet", "maxAmount": "1", "type": "airdrop"},
+		{"name": "Game", "appId": 42, "type": "spend"}
+	]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assetMap := map[uint64]models.Asset{}
+	deposit := func(sender string, amount uint64, note string) []models.Transaction {
+		return []models.Transaction{{
+			Id:                 "TX",
+			Type:               "pay",
+			Sender:             sender,
+			Note:               []byte(note),
+			PaymentTransaction: models.TransactionPayment{Amount: amount, Receiver: testAccount},
+		}}
+	}
+	for _, test := range []struct {
+		name    string
+		txns    []models.Transaction
+		matched bool
+		check   func(r ExportRecord) bool
+		comment string
+	}{
+		{"sender", deposit("PROJECT", 5000000, ""), true, func(r ExportRecord) bool { return r.staking }, "Project staking"},
+		{"note and amount", deposit("FAUCET", 1000000, "faucet drip"), true, func(r ExportRecord) bool { return r.airdrop }, "Faucet"},
+		{"amount too large", deposit("FAUCET", 1000001, "faucet drip"), false, nil, ""},
+		{"note mismatch", deposit("FAUCET", 1000000, "drip"), false, nil, ""},
+		{"application", []models.Transaction{
+			// Newest first.
+			{Id: "CALL", Type: "appl", Sender: testAccount, Fee: 1000,
+				ApplicationTransaction: models.TransactionApplication{ApplicationId: 42, OnCompletion: "noop"}},
+			{Id: "PAY", Type: "pay", Sender: testAccount, Fee: 1000,
+				PaymentTransaction: models.TransactionPayment{Amount: 5000000, Receiver: "GAME"}},
+		}, true, func(r ExportRecord) bool { return r.spend }, "Game"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var records []ExportRecord
+			for _, tx := range test.txns {
+				filtered, err := FilterTransaction(tx, "", testAccount, assetMap)
+				if err != nil {
+					t.Fatal(err)
+				}
+				records = append(records, filtered...)
+			}
+			records, matched, err := rules.Apply(records, test.txns, assetMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if matched != test.matched {
+				t.Fatalf("matched: got %v, want %v", matched, test.matched)
+			}
+			if !matched {
+				return
+			}
+			for _, r := range records {
+				if r.feeTx {
+					if r.spend {
+						t.Error("fee record was classified")
+					}
+					continue
+				}
+				if !test.check(r) || r.comment != test.comment {
+					t.Errorf("got %+v, want comment %q", r, test.comment)
+				}
+			}
+		})
+	}
+
+	var none *Rules
+	records, err := FilterTransaction(deposit("PROJECT", 5000000, "")[0], "", testAccount, assetMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, matched, err := none.Apply(records, nil, assetMap); matched || err != nil {
+		t.Errorf("nil rules: got matched %v, error %v", matched, err)
+	}
+}
+
+func TestLoadRulesInvalid(t *testing.T) {
+	for _, test := range []struct {
+		rule string
+		want string
+	}{
+		{`{"name": "x", "sender": "A", "type": "gift"}`, "unknown type"},
+		{`{"name": "x", "type": "airdrop"}`, "no conditions"},
+		{`{"name": "x", "noteRegex": "(", "type": "airdrop"}`, "invalid noteRegex"},
+		{`{"name": "x", "minAmount": "one", "type": "airdrop"}`, "invalid amount"},
+	} {
+		file := filepath.Join(t.TempDir(), "rules.json")
+		if err := ioutil.WriteFile(file, []byte(`{"rules": [`+test.rule+`]}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRules(file); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.rule, err, test.want)
+		}
+	}
+}
+
+func TestRulesDoNotOverrideHandlers(t *testing.T) {
+	const usdc = 31566704
+	assetMap := map[uint64]models.Asset{
+		usdc: {Index: usdc, Params: models.AssetParams{UnitName: "USDC", Decimals: 6}},
+	}
+	assetID := uint64(usdc)
+	rules := &Rules{Rules: []*Rule{{Name: "USDC income", AssetID: &assetID, Type: "income"}}}
+	if err := rules.Rules[0].compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A Tinyman V2 swap of ALGO for USDC, newest first.
+	txns := applGroup(1002541853, "swap",
+		models.Transaction{Sender: "POOL", AssetTransferTransaction: models.TransactionAssetTransfer{AssetId: usdc, Amount: 300, Receiver: testAccount}},
+		models.Transaction{Type: "pay", Sender: testAccount, PaymentTransaction: models.TransactionPayment{Amount: 1000, Receiver: "POOL"}},
+	)
+	records, _, err := NormalizeRecords(nil, filterGroup(t, txns, assetMap), txns, assetMap, ApplState{}, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r.reward || r.comment == "USDC income" {
+			t.Errorf("rule applied to a handled group: %+v", r)
+		}
+	}
+	if !records[0].trade {
+		t.Errorf("got %+v, want a trade", records[0])
+	}
+
+	// The same deposit outside of an application group is classified by the rule.
+	deposit := txns[1:2]
+	deposit[0].Group = nil
+	records, _, err = NormalizeRecords(nil, filterGroup(t, deposit, assetMap), deposit, assetMap, ApplState{}, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !records[0].reward || records[0].comment != "USDC income" {
+		t.Errorf("got %+v, want the rule to apply", records[0])
+	}
+}
@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+// UnclassifiedReport lists the transaction groups exported as plain deposits and withdrawals because
+// no rule could interpret them, as CSV for manual review.
+type UnclassifiedReport struct {
+	writer *csv.Writer
+	groups int
+}
+
+// NewUnclassifiedReport writes the report header to writer.
+func NewUnclassifiedReport(writer io.Writer) *UnclassifiedReport {
+	u := &UnclassifiedReport{writer: csv.NewWriter(writer)}
+	u.writer.Write([]string{"Date", "Round", "Tx-ID", "Group ID", "App ID", "First Arg", "Reason", "Records"})
+	u.writer.Flush()
+	return u
+}
+
+// Add adds the group if any of its records is unclassified. records are the NormalizeRecords records of txns.
+func (u *UnclassifiedReport) Add(records []ExportRecord, txns []models.Transaction, assetMap map[uint64]models.Asset) error {
+	var reason string
+	for _, r := range records {
+		if r.unclassified != "" {
+			reason = r.unclassified
+			break
+		}
+	}
+	if reason == "" || len(txns) == 0 {
+		return nil
+	}
+
+	// Transactions are returned newest first, the group is identified by its first transaction.
+	first := txns[len(txns)-1]
+	var appID string
+	if appl, err := ExtractApplication(txns); err == nil {
+		appID = strconv.FormatUint(appl.ApplicationId, 10)
+	}
+	_, firstArg := ExtractFirstArg(txns)
+
+	f := newAssetFormatter(assetMap)
+	var summary []string
+	for _, r := range records {
+		switch {
+		case r.feeTx || r.reward:
+			continue
+		case r.recvQty != 0:
+			summary = append(summary, fmt.Sprintf("received %s %s from %s", f.amount(r.recvQty, r.recvASA), f.currency(r.recvASA), r.sender))
+		case r.sentQty != 0:
+			summary = append(summary, fmt.Sprintf("sent %s %s to %s", f.amount(r.sentQty, r.sentASA), f.currency(r.sentASA), r.receiver))
+		}
+	}
+	if f.err != nil {
+		return f.err
+	}
+
+	u.writer.Write([]string{
+		time.Unix(int64(first.RoundTime), 0).UTC().Format("2006-01-02T15:04:05Z"),
+		strconv.FormatUint(first.ConfirmedRound, 10),
+		first.Id,
+		base64.StdEncoding.EncodeToString(first.Group),
+		appID,
+		printableArg(firstArg),
+		reason,
+		strings.Join(summary, " | "),
+	})
+	u.writer.Flush()
+	u.groups++
+	return u.writer.Error()
+}
+
+// Len returns the number of groups in the report.
+func (u *UnclassifiedReport) Len() int {
+	return u.groups
+}
+
+// printableArg returns an application argument as text, or base64 encoded if it is binary.
+func printableArg(arg string) string {
+	if utf8.ValidString(arg) && strings.IndexFunc(arg, func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return arg
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString([]byte(arg))
+}
@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func TestUnclassifiedReport(t *testing.T) {
+	assetMap := map[uint64]models.Asset{}
+	group := []byte("group")
+	deposit := func(id string, note string) []models.Transaction {
+		return []models.Transaction{{
+			Id:                 id,
+			Type:               "pay",
+			Sender:             "SENDER",
+			ConfirmedRound:     10,
+			RoundTime:          1640000000,
+			Note:               []byte(note),
+			PaymentTransaction: models.TransactionPayment{Amount: 2000000, Receiver: testAccount},
+		}}
+	}
+	for _, test := range []struct {
+		name string
+		txns []models.Transaction
+		want string
+	}{
+		{"deposit", deposit("DEPOSIT", ""), "2021-12-20T11:33:20Z,10,DEPOSIT,,,,deposit not matched by the airdrop and reward rules,received 2.000000 ALGO from SENDER"},
+		{"airdrop", deposit("AIRDROP", "airdrop"), ""},
+		{"application", []models.Transaction{
+			// Newest first.
+			{Id: "CALL", Type: "appl", Sender: testAccount, Fee: 1000, Group: group, ConfirmedRound: 11, RoundTime: 1640000100,
+				ApplicationTransaction: models.TransactionApplication{ApplicationId: 42, OnCompletion: "noop", ApplicationArgs: [][]byte{[]byte("swap")}}},
+			{Id: "PAY", Type: "pay", Sender: testAccount, Fee: 1000, Group: group, ConfirmedRound: 11, RoundTime: 1640000100,
+				PaymentTransaction: models.TransactionPayment{Amount: 5000000, Receiver: "APP"}},
+		}, "2021-12-20T11:35:00Z,11,PAY,Z3JvdXA=,42,swap,no handler for application ID 42,sent 5.001000 ALGO to APP"},
+		{"application airdrop", []models.Transaction{
+			{Id: "DISTRIBUTE", Type: "appl", Sender: "DISTRIBUTOR", Fee: 1000, ConfirmedRound: 13,
+				ApplicationTransaction: models.TransactionApplication{ApplicationId: 42, OnCompletion: "noop"},
+				InnerTxns:              deposit("DROP", "airdrop")},
+		}, ""},
+		{"fees only", []models.Transaction{
+			{Id: "OPTIN", Type: "appl", Sender: testAccount, Fee: 1000, ConfirmedRound: 12,
+				ApplicationTransaction: models.TransactionApplication{ApplicationId: 42, OnCompletion: "optin"}},
+		}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var records []ExportRecord
+			for _, tx := range test.txns {
+				for _, inner := range tx.InnerTxns {
+					filtered, err := FilterTransaction(inner, "inner-"+tx.Id, testAccount, assetMap)
+					if err != nil {
+						t.Fatal(err)
+					}
+					records = append(records, filtered...)
+				}
+				filtered, err := FilterTransaction(tx, "", testAccount, assetMap)
+				if err != nil {
+					t.Fatal(err)
+				}
+				records = append(records, filtered...)
+			}
+			records, _, err := NormalizeRecords(nil, records, test.txns, assetMap, ApplState{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			report := NewUnclassifiedReport(&out)
+			if err := report.Add(records, test.txns, assetMap); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+			if got := strings.Join(lines, "\n"); got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+			if want := len(lines); report.Len() != want {
+				t.Errorf("Len: got %d, want %d", report.Len(), want)
+			}
+		})
+	}
+}
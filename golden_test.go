@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/m4dc0w/algo-export/exporter"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// goldenFixture is a recorded account history used by the golden tests.
+// Transactions are listed in indexer order (newest first), including any inner transactions.
+type goldenFixture struct {
+	Account      string
+	Assets       []models.Asset
+	Transactions []models.Transaction
+}
+
+// fixtureSource serves asset lookups from a goldenFixture.
+type fixtureSource struct {
+	assets map[uint64]models.Asset
+}
+
+func (s *fixtureSource) LookupAccountTransactions(account string, query transactionQuery, nextToken string) (models.TransactionsResponse, error) {
+	return models.TransactionsResponse{}, fmt.Errorf("account transactions are not available in fixtures")
+}
+
+func (s *fixtureSource) LookupAssetByID(assetID uint64) (models.Asset, error) {
+	asset, ok := s.assets[assetID]
+	if !ok {
+		return asset, fmt.Errorf("asset id %d not in fixture", assetID)
+	}
+	return asset, nil
+}
+
+func loadFixture(t *testing.T, file string) (goldenFixture, *fixtureSource) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture goldenFixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatalf("parsing %s: %v", file, err)
+	}
+	source := &fixtureSource{assets: map[uint64]models.Asset{}}
+	for _, asset := range fixture.Assets {
+		source.assets[asset.Index] = asset
+	}
+	return fixture, source
+}
+
+func exportFixture(t *testing.T, file string, export exporter.Interface) []byte {
+	fixture, source := loadFixture(t, file)
+
+	var out bytes.Buffer
+	export.WriteHeader(&out)
+	accountExport := newAccountExport(nil, source, export, fixture.Account, map[uint64]models.Asset{}, newState(), &out)
+	for _, tx := range fixture.Transactions {
+		if err := accountExport.addTransaction(tx); err != nil {
+			t.Fatalf("exporting %s: %v", file, err)
+		}
+	}
+	if err := accountExport.finish(); err != nil {
+		t.Fatalf("exporting %s: %v", file, err)
+	}
+	return out.Bytes()
+}
+
+// goldenFormats are the exporters of the golden tests, by the suffix of their golden files.
+var goldenFormats = []struct {
+	suffix string
+	export func() exporter.Interface
+}{
+	{".csv", exporter.NewcointrackingExporter},
+	{".koinly.csv", exporter.NewkoinlyExporter},
+}
+
+// TestGolden exports every fixture in testdata/golden in every format and compares the result to the
+// matching .csv file (.koinly.csv for Koinly). Run with -update to regenerate the golden files.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fixtures found in testdata/golden")
+	}
+	for _, file := range files {
+		for _, format := range goldenFormats {
+			file, format := file, format
+			golden := strings.TrimSuffix(file, ".json") + format.suffix
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				testGolden(t, file, golden, format.export())
+			})
+		}
+	}
+}
+
+func testGolden(t *testing.T, file, golden string, export exporter.Interface) {
+	got := exportFixture(t, file, export)
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("export of %s does not match %s\ngot:\n%s\nwant:\n%s", file, golden, got, want)
+	}
+}
@@ -1,22 +1,19 @@
 package main
 
 import (
-	"encoding/base64"
 	"bytes"
-	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/algorand/go-algorand-sdk/client/v2/common"
 	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
-	"github.com/algorand/go-algorand-sdk/client/v2/indexer"
 	"github.com/algorand/go-algorand-sdk/types"
 	"github.com/m4dc0w/algo-export/exporter"
 )
@@ -39,16 +36,72 @@ func (al *accountList) Set(value string) error {
 	return nil
 }
 
+// assetIDList is a list of comma delimited asset IDs, or "all" for every asset.
+type assetIDList struct {
+	all      bool
+	assetIDs []uint64
+}
+
+func (l *assetIDList) String() string {
+	if l.all {
+		return "all"
+	}
+	return fmt.Sprint(l.assetIDs)
+}
+
+func (l *assetIDList) Set(value string) error {
+	*l = assetIDList{}
+	if strings.EqualFold(value, "all") {
+		l.all = true
+		return nil
+	}
+	for _, val := range strings.Split(value, ",") {
+		assetID, err := strconv.ParseUint(strings.TrimSpace(val), 10, 64)
+		if err != nil {
+			return fmt.Errorf("asset id:%v not valid: %w", val, err)
+		}
+		l.assetIDs = append(l.assetIDs, assetID)
+	}
+	return nil
+}
+
 func main() {
 	var (
 		accounts         accountList
+		refreshAssets    assetIDList
 		formatFlag       = flag.String("f", exporter.Formats()[0], fmt.Sprintf("Format to export: [%s]", strings.Join(exporter.Formats(), ", ")))
 		hostAddrFlag     = flag.String("s", "localhost:8980", "Index server to connect to")
-		apiKey           = flag.String("api", "", "Optional API Key for local indexer, or for PureStake")
-		pureStakeApiFlag = flag.Bool("p", false, "Use PureStake API - ignoring -s argument")
+		apiKey           = flag.String("api", "", "Optional API Key for local indexer")
+		endpointsFlag    = flag.String("endpoints", defaultEndpointsFile(), "File of named indexer and algod endpoint profiles")
+		endpointFlag     = flag.String("endpoint", "", "Optional endpoint profile to connect to - ignoring -s, -api and -algod arguments")
+		algodFlag        = flag.String("algod", "", "Optional archival algod node to walk blocks from instead of using an indexer - ignoring -s argument")
+		algodTokenFlag   = flag.String("algod-token", "", "API token of the -algod node")
 		outDirFlag       = flag.String("o", "", "output directory path for exported files")
+		recordDirFlag    = flag.String("record", "", "Record indexer transactions and assets to a directory for later replay")
+		replayDirFlag    = flag.String("replay", "", "Replay transactions and assets from a recorded directory instead of the indexer")
+		pricesFlag       = flag.String("prices", "", "Optional CSV or JSON file of daily prices by asset ID used for record values")
+		currencyFlag     = flag.String("currency", "USD", "Currency of the prices file")
+		gainsFlag        = flag.String("gains", "", fmt.Sprintf("Optional realized gains report using lot method: [%s]", strings.Join(exporter.LotMethods(), ", ")))
+		workersFlag      = flag.Int("workers", 4, "Number of accounts to export concurrently")
+		rateFlag         = flag.Float64("rate", 0.5, "Maximum indexer requests per second shared by all accounts (0 for no limit, algod has no limit by default)")
+		burstFlag        = flag.Int("burst", 1, "Maximum burst of indexer requests above -rate")
+		retriesFlag      = flag.Int("retries", defaultRetries, "Number of times a failed indexer request is retried")
+		retryWaitFlag    = flag.Duration("retry-wait", defaultRetryWait, "Wait before the first retry, doubled for each further retry")
+		retryBudgetFlag  = flag.Int("retry-budget", 100, "Maximum number of retries of a run, shared by all accounts")
+		rulesFlag        = flag.String("rules", "", "Optional JSON file of classification rules evaluated before the built-in rules")
+		unclassifiedFlag = flag.Bool("unclassified", false, "Write a report of the transaction groups that could not be classified, for manual review")
+		logLevelFlag     = flag.String("log-level", "info", "Log level: [debug, info, warn, error]")
+		logFormatFlag    = flag.String("log-format", "text", "Log format: [text, json]")
+		quietFlag        = flag.Bool("q", false, "Quiet, only log errors")
+		stateFlag        = flag.String("state", defaultStateFile(), "State file tracking the last exported round of each account")
+		stateBackupsFlag = flag.Int("state-backups", 3, "Number of previous state files kept as <state>.1 to <state>.N")
+		startRoundFlag   = flag.Uint64("start-round", 0, "Optional first round of a stand-alone export which leaves the state file untouched")
+		endRoundFlag     = flag.Uint64("end-round", 0, "Optional last round of a stand-alone export which leaves the state file untouched")
+		startDateFlag    = flag.String("start-date", "", "Optional first day (YYYY-MM-DD, UTC) of a stand-alone export which leaves the state file untouched")
+		endDateFlag      = flag.String("end-date", "", "Optional last day (YYYY-MM-DD, UTC) of a stand-alone export which leaves the state file untouched")
 	)
 	flag.Var(&accounts, "a", "Account or list of comma delimited accounts to export")
+	flag.Var(&refreshAssets, "refresh-assets", "Asset ID or list of comma delimited asset IDs to look up again instead of using the asset cache, or \"all\"")
 	flag.Parse()
 
 	if len(accounts) == 0 {
@@ -63,53 +116,147 @@ func main() {
 		os.Exit(1)
 	}
 
-	client, err := getClient(*hostAddrFlag, *apiKey, *pureStakeApiFlag)
+	logLevel, err := exporter.ParseLevel(*logLevelFlag)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	if !fileExist(*outDirFlag) {
-		if err = os.MkdirAll(*outDirFlag, 0755); err != nil {
+	if *quietFlag {
+		logLevel = exporter.LevelError
+	}
+	if *logFormatFlag != "text" && *logFormatFlag != "json" {
+		fmt.Println("Unknown log format:", *logFormatFlag)
+		os.Exit(1)
+	}
+	logger := exporter.NewLogger(os.Stderr, logLevel, *logFormatFlag == "json")
+
+	var gainsMethod exporter.LotMethod
+	if *gainsFlag != "" {
+		method, err := exporter.ParseLotMethod(*gainsFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		gainsMethod = method
+	}
+
+	var prices exporter.PriceSource
+	if *pricesFlag != "" {
+		filePrices, err := exporter.LoadPriceFile(*pricesFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		prices = filePrices
+	}
+
+	var rules *exporter.Rules
+	if *rulesFlag != "" {
+		if rules, err = exporter.LoadRules(*rulesFlag); err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 	}
 
-	if err := exportAccounts(client, export, accounts, *outDirFlag); err != nil {
+	window, err := parseExportWindow(*startRoundFlag, *endRoundFlag, *startDateFlag, *endDateFlag)
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-}
 
-func getClient(serverFlag string, apiKey string, usePureStake bool) (*indexer.Client, error) {
-	var (
-		client     *indexer.Client
-		serverAddr *url.URL
-		err        error
-	)
-	if !usePureStake {
-		serverAddr, err = url.Parse(fmt.Sprintf("http://%s", serverFlag))
-		if err != nil {
-			return nil, fmt.Errorf("error in server address: %w", err)
-		}
-		client, err = indexer.MakeClient(serverAddr.String(), apiKey)
+	if *recordDirFlag != "" && *replayDirFlag != "" {
+		fmt.Println("Only one of -record or -replay can be specified.")
+		os.Exit(1)
+	}
+
+	var source transactionSource
+	if *replayDirFlag != "" {
+		replay, err := newReplaySource(*replayDirFlag)
 		if err != nil {
-			return nil, fmt.Errorf("error creating indexer client: %w", err)
+			fmt.Println(err)
+			os.Exit(1)
 		}
+		source = replay
 	} else {
-		commonClient, err := common.MakeClientWithHeaders("https://mainnet-algorand.api.purestake.io/idx2", "X-API-Key", apiKey, []*common.Header{})
+		// -s and -algod are plain http endpoints without a profile.
+		profile := endpointProfile{Type: endpointIndexer, URL: *hostAddrFlag, Scheme: "http", Token: *apiKey}
+		if *algodFlag != "" {
+			profile = endpointProfile{Type: endpointAlgod, URL: *algodFlag, Scheme: "http", Token: *algodTokenFlag}
+		}
+		if *endpointFlag != "" {
+			config, err := loadEndpoints(*endpointsFlag)
+			if err == nil {
+				profile, err = config.profile(*endpointFlag)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		// -rate and -burst on the command line override the limit of the profile.
+		limiter := profile.rateLimiter(*rateFlag, *burstFlag)
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "rate" || f.Name == "burst" {
+				limiter = newRateLimiter(*rateFlag, *burstFlag)
+			}
+		})
+		var accountNames []string
+		for _, account := range accounts {
+			accountNames = append(accountNames, account.String())
+		}
+		installStatusTransport()
+		var err error
+		source, err = newEndpointSource(profile, limiter, accountNames)
 		if err != nil {
-			return nil, fmt.Errorf("error creating indexer client to purestake: %w", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		source = newRetrySource(source, *retriesFlag, *retryWaitFlag, newRetryBudget(*retryBudgetFlag), logger)
+		if *recordDirFlag != "" {
+			source = newRecordSource(source, *recordDirFlag)
+		}
+	}
+	if !fileExist(*outDirFlag) {
+		if err := os.MkdirAll(*outDirFlag, 0755); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
-		client = (*indexer.Client)(commonClient)
 	}
-	return client, err
+
+	options := exportOptions{
+		outDir:        *outDirFlag,
+		gainsMethod:   gainsMethod,
+		prices:        prices,
+		currency:      *currencyFlag,
+		stateBackups:  *stateBackupsFlag,
+		workers:       *workersFlag,
+		refreshAssets: refreshAssets,
+		// Recordings restart unfinished exports, so the recording is complete.
+		resume:       *recordDirFlag == "",
+		window:       window,
+		unclassified: *unclassifiedFlag,
+		rules:        rules,
+	}
+	// Recordings, replays and stand-alone exports start from an empty state and never update the saved state.
+	// A recording starts with the account's first round, as its replay does.
+	if *recordDirFlag == "" && *replayDirFlag == "" && window == nil {
+		options.stateFile = *stateFlag
+	}
+	// Recordings and replays look up every asset, so the recording is complete.
+	if *recordDirFlag == "" && *replayDirFlag == "" {
+		options.assetCacheFile = assetCacheFile(*stateFlag)
+	}
+	options.log = logger
+	if err := exportAccounts(source, export, accounts, options); err != nil {
+		logger.Error("export failed", "error", err)
+		os.Exit(1)
+	}
 }
 
-func toExportRecords(client *indexer.Client, export exporter.Interface, account string, assetMap map[uint64]models.Asset, topTxID string, txns []models.Transaction) ([]exporter.ExportRecord, error) {
+func toExportRecords(log *exporter.Logger, source transactionSource, export exporter.Interface, account string, assetMap map[uint64]models.Asset, topTxID string, txns []models.Transaction) ([]exporter.ExportRecord, error) {
 	var records []exporter.ExportRecord
 	for index, tx := range txns {
-		fmt.Printf("  Converting Tx Type: %s | TxID: %s | Sender: %s\n", tx.Type, tx.Id, tx.Sender)
+		log.Debug("converting transaction", "type", tx.Type, "txid", tx.Id, "sender", tx.Sender)
 		if topTxID != "" {
 			topTxID = fmt.Sprintf("%d-%s", index, topTxID)  // Keep an unique id each inner transaction.
 		}
@@ -120,8 +267,8 @@ func toExportRecords(client *indexer.Client, export exporter.Interface, account
 			if topTxID == "" {
 				uniqueTxID = "inner-" + tx.Id  // Initialize to top level transaction id.
 			}
-			fmt.Printf("    processing %d inner transaction(s) for transaction id: %s\n", len(tx.InnerTxns), tx.Id)
-			innerRecords, err := toExportRecords(client, export, account, assetMap, uniqueTxID, tx.InnerTxns)
+			log.Debug("processing inner transactions", "txid", tx.Id, "count", len(tx.InnerTxns))
+			innerRecords, err := toExportRecords(log, source, export, account, assetMap, uniqueTxID, tx.InnerTxns)
 			if err != nil {
 				return records, err
 			}
@@ -131,329 +278,601 @@ func toExportRecords(client *indexer.Client, export exporter.Interface, account
 		// Populate assetMap if entry does not exist.
 		if tx.AssetTransferTransaction.AssetId != 0 {
 			if _, ok := assetMap[tx.AssetTransferTransaction.AssetId]; !ok {
-				// Rate limited to <1 request per second.
-				time.Sleep(2 * time.Second)
-
-				lookupASA := client.LookupAssetByID(tx.AssetTransferTransaction.AssetId)
-				_, asset, err := lookupASA.Do(context.TODO())
+				asset, err := source.LookupAssetByID(tx.AssetTransferTransaction.AssetId)
 				if err != nil {
-					return records, fmt.Errorf("error looking up asset id: %w", err)
+					return records, err
 				}
-				fmt.Printf("    looked up | Asset ID: %d | UnitName: %s | Name: %s | Decimals: %d |\n", asset.Index, asset.Params.UnitName, asset.Params.Name, asset.Params.Decimals)
+				log.Debug("looked up asset", "asset", asset.Index, "unit", asset.Params.UnitName, "name", asset.Params.Name, "decimals", asset.Params.Decimals)
 				assetMap[tx.AssetTransferTransaction.AssetId] = asset
 			}
 		}
 
-		records = append(records, exporter.FilterTransaction(tx, topTxID, account, assetMap)...)
+		filtered, err := exporter.FilterTransaction(tx, topTxID, account, assetMap)
+		if err != nil {
+			return records, err
+		}
+		records = append(records, filtered...)
 	}
 	return records, nil
 }
 
-func writeRecords(export exporter.Interface, outCsv io.Writer, assetMap map[uint64]models.Asset, records []exporter.ExportRecord) {
+func writeRecords(log *exporter.Logger, export exporter.Interface, outCsv io.Writer, assetMap map[uint64]models.Asset, records []exporter.ExportRecord) error {
 	for _, record := range records {
-		fmt.Printf("Writing %s\n", record.String())
-		export.WriteRecord(outCsv, assetMap, record)
+		log.Debug("writing record", "record", record.String())
+		if err := export.WriteRecord(outCsv, assetMap, record); err != nil {
+			return fmt.Errorf("unable to write record %s: %w", record.String(), err)
+		}
 	}
+	return nil
 }
 
-func normalizeTransactions(client *indexer.Client, export exporter.Interface, account string, assetMap map[uint64]models.Asset, topTxID string, txns []models.Transaction) ([]exporter.ExportRecord, bool, error) {
-	fmt.Printf("\nExport %d Transactions\n", len(txns))
-	
-	var deferred bool
+func normalizeTransactions(log *exporter.Logger, source transactionSource, export exporter.Interface, account string, assetMap map[uint64]models.Asset, applState exporter.ApplState, rules *exporter.Rules, topTxID string, txns []models.Transaction) ([]exporter.ExportRecord, bool, error) {
+	log.Debug("exporting transactions", "count", len(txns))
 
-	records, err := toExportRecords(client, export, account, assetMap, topTxID, txns)
+	records, err := toExportRecords(log, source, export, account, assetMap, topTxID, txns)
 	if err != nil {
-		return records, deferred, err
+		return records, false, err
 	}
+	return exporter.NormalizeRecords(log, records, txns, assetMap, applState, rules)
+}
 
-	// Applications (e.g. DeFi, Liquidity Pool) are usually part of a Group transaction.
-	if len(txns) > 1 && len(txns[0].Group) > 0 {
-		// Group ID.
-		groupID := base64.StdEncoding.EncodeToString(txns[0].Group)
-		appl, err := exporter.ExtractApplication(txns)
-		if err != nil {
-			fmt.Printf("error finding application: %w", err)
-		}
-		err = nil
-
-		fmt.Printf("  Processing Application ID: %d | group id: %s\n", appl.ApplicationId, groupID)
-
-		switch appl.ApplicationId {
-			// https://docs.tinyman.org/contracts
-			// Version 1.1 - Mainnet Validator App ID: 552635992
-			// Version 1.0 - Mainnet Validator App ID: 350338509
-			case 552635992, 350338509:
-				records, err = exporter.ApplTinyman(records, txns)
-				return records, deferred, err
-
-			// Yieldly No-Loss Lottery.
-			// https://app.yieldly.finance/algo-prize-game
-			case 233725844:
-				records, err = exporter.ApplYieldlyAlgoPrizeGame(records, txns)
-				return records, deferred, err
-
-			// Yieldly Staking Pool one to two.
-			case 233725850:	// YLDY -> YLDY/ALGO
-				records, err = exporter.ApplYieldlyStakingPoolsYLDYALGO(records, txns)
-				return records, deferred, err
-
-			// Yieldly Staking Pools one to one.
-			// https://app.yieldly.finance/pools			
-			case 348079765, // YLDY -> OPUL
-				352116819,		// YLDY -> SMILE
-				367431051,		// OPUL -> OPUL
-				373819681,		// SMILE -> SMILE
-				385089192,		// YLDY -> ARCC
-				393388133,		// YLDY -> GEMS
-				419301793,		// GEMS -> GEMS
-				424101057,		// YLDY -> XET
-				447336112,		// YLDY -> CHOICE
-				464365150,		// CHOICE -> CHOICE
-				498747685,		// ARCC -> ARCC
-				511597182,		// YLDY -> AKITA
-				583357499,		// YLDY -> ARCC
-				593126242,		// YLDY -> KTNC
-				591414576,		// YLDY -> DEFLY
-				593270704,		// YLDY -> TINY
-				593289960,		// YLDY -> TREES
-				593324268,		// YLDY -> BLOCK
-				596950925:		// YLDY -> HDL
-				records, err = exporter.ApplYieldlyStakingPools(records, txns)
-				return records, deferred, err
-			
-			// Yieldly Liquidity Pools.
-			// https://app.yieldly.finance/liquidity-pools
-			case 511593477, // AKITA/ALGO LP -> YLDY
-				556355279,		// AKTA/ALGO LP -> YLDY
-				568949192,		// XET/YLDY LP -> YLDY
-				583355704,		// ARCC/YLDY LP -> YLDY
-				591416743,		// DEFLY/YLDY LP -> YLDY
-				593133882,		// KTNC/YLDY LP -> YLDY
-				593278929,		// TINY/YLDY LP -> YLDY
-				593294372,		// TREES/YLDY LP -> YLDY
-				593337625,		// BLOCK/YLDY LP -> YLDY
-				596954871:		// HDL/YLDY LP -> YLDY
-				records, err = exporter.ApplYieldlyLiquidityPools(records, txns)
-				return records, deferred, err
-
-			// Yieldly Distribution Pools.
-			// https://app.yieldly.finance/distribution
-			case 470390215,	// XET -> XET
-				596947890:		// HDL -> HDL
-				records, err = exporter.ApplYieldlyDistributionPools(records, txns)
-				return records, deferred, err
-
-			// AlgoFi
-			// https://app.algofi.org/
-			case 465814065, // ALGO
-				465814103,    // USDC
-				465814149,    // goBTC
-				465814222,    // goETH
-				465814278:    // STBL
-				deferred = true
-				return records, deferred, err
-
-			// AlgoFi Staking
-			// https://app.algofi.org/staking
-			case 465865291, // STBL -> STBL
-				553869413:    // STBL-USDC-LP-V2 -> ALGO/STBL
-				fmt.Printf("    AlgoFi Staking for Application ID: %d | group id: %s\n", appl.ApplicationId, groupID)
-				return records, deferred, err
-
-			// AKITA -> AKTA swap
-			// https://swap.akita.community/
-			// https://algoexplorer.io/application/537279393
-			case 537279393:
-				records, err = exporter.ApplAkitaTokenSwap(records)
-				return records, deferred, err
-			default:
-				fmt.Printf("    Noop for Application ID: %d | group id: %s\n", appl.ApplicationId, groupID)
+// accountExport groups the transactions of a single account and writes the exported records.
+// Groups of deferred application handlers (e.g. AlgoFi) are exported when finish is called.
+type accountExport struct {
+	log      *exporter.Logger
+	source   transactionSource
+	export   exporter.Interface
+	account  string
+	assetMap map[uint64]models.Asset
+	state    *state
+	out      io.Writer
+	gains    map[exporter.LotMethod]*exporter.GainsTracker
+
+	prices        exporter.PriceSource
+	currency      string
+	missingPrices exporter.MissingPrices
+	unclassified  *exporter.UnclassifiedReport
+	rules         *exporter.Rules
+
+	txnsGroup       []models.Transaction
+	lastRound       uint64 // Round of the last exported group.
+	lastGroup       []byte
+	recordsDeferred [][]exporter.ExportRecord
+	txnsDeferred    [][]models.Transaction
+}
+
+func newAccountExport(log *exporter.Logger, source transactionSource, export exporter.Interface, account string, assetMap map[uint64]models.Asset, accountState *state, out io.Writer) *accountExport {
+	return &accountExport{
+		log:      log,
+		source:   source,
+		export:   export,
+		account:  account,
+		assetMap: assetMap,
+		state:    accountState,
+		out:      out,
+	}
+}
+
+// priceRecords enables the record values from prices.
+func (a *accountExport) priceRecords(prices exporter.PriceSource, currency string) {
+	a.prices = prices
+	a.currency = currency
+	a.missingPrices = exporter.MissingPrices{}
+}
+
+// trackGains enables the realized gains calculation of every lot method, continuing from the lots saved in
+// the account state. The lots are updated on every run, so a later report with any method starts from them.
+func (a *accountExport) trackGains(prices exporter.PriceSource) {
+	a.gains = map[exporter.LotMethod]*exporter.GainsTracker{}
+	for _, method := range exporter.LotMethods() {
+		method := exporter.LotMethod(method)
+		a.gains[method] = exporter.NewGainsTracker(method, prices, a.state.Lots[method])
+	}
+}
+
+// processGains calculates the realized gains and saves the open lots to the account state, built to endRound.
+func (a *accountExport) processGains(endRound uint64) {
+	lots := map[exporter.LotMethod]exporter.Lots{}
+	for method, gains := range a.gains {
+		gains.Process(a.assetMap)
+		lots[method] = gains.Lots()
+	}
+	a.state.Lots = lots
+	a.state.LotsRound = endRound
+}
+
+// writeGains writes the realized gains report of method after processGains.
+func (a *accountExport) writeGains(method exporter.LotMethod, out io.Writer) error {
+	if err := a.gains[method].WriteReport(out, a.assetMap); err != nil {
+		return fmt.Errorf("unable to write gains report: %w", err)
+	}
+	return nil
+}
+
+func (a *accountExport) writeRecords(records []exporter.ExportRecord) error {
+	if a.prices != nil {
+		records = exporter.PriceRecords(records, a.prices, a.currency, a.assetMap, a.missingPrices)
+	}
+	if err := writeRecords(a.log, a.export, a.out, a.assetMap, records); err != nil {
+		return err
+	}
+	for _, gains := range a.gains {
+		for _, record := range records {
+			gains.Add(record)
 		}
+	}
+	return nil
+}
 
-		if err != nil {
-			fmt.Printf("error exporting application ID %d: %w", appl.ApplicationId, err)
-			return records, deferred, err
+// addTransaction adds a transaction, exporting the previous group once a new group starts.
+func (a *accountExport) addTransaction(tx models.Transaction) error {
+	// Transaction is in same group.
+	if len(a.txnsGroup) > 0 && len(tx.Group) > 0 && bytes.Equal(tx.Group, a.txnsGroup[0].Group) {
+		a.txnsGroup = append(a.txnsGroup, tx)
+		return nil
+	}
+	// Current transaction is in different group, so export previous transaction group.
+	if err := a.exportGroup(); err != nil {
+		return err
+	}
+	a.txnsGroup = append(a.txnsGroup, tx)
+	return nil
+}
+
+func (a *accountExport) exportGroup() error {
+	if len(a.txnsGroup) == 0 {
+		return nil
+	}
+	records, deferred, err := normalizeTransactions(a.log, a.source, a.export, a.account, a.assetMap, a.state.Appl, a.rules, "", a.txnsGroup)
+	if err != nil {
+		return err
+	}
+	if deferred {
+		a.recordsDeferred = append(a.recordsDeferred, records)
+		a.txnsDeferred = append(a.txnsDeferred, a.txnsGroup)
+	} else {
+		if err := a.writeRecords(records); err != nil {
+			return err
 		}
+		if a.unclassified != nil {
+			if err := a.unclassified.Add(records, a.txnsGroup, a.assetMap); err != nil {
+				return fmt.Errorf("unable to write unclassified report: %w", err)
+			}
+		}
+	}
+	a.lastRound = a.txnsGroup[0].ConfirmedRound
+	a.lastGroup = a.txnsGroup[0].Group
+	a.txnsGroup = nil // Reset group.
+	return nil
+}
+
+// finish exports the final transaction group followed by the deferred groups.
+func (a *accountExport) finish() error {
+	// Export final transaction(s).
+	if err := a.exportGroup(); err != nil {
+		return err
 	}
 
-	// Assume Mining transactions are usually done in 1 ASA deposit transaction.
-	if exporter.IsLengthExcludeReward(records, 1) && records[0].IsASADeposit() {
-		var err error
-		r := records[0]
-		switch {
-		case r.IsAssetIDDeposit(27165954):
-			records, err = exporter.MiningPlanets(records)
-			return records, deferred, err
+	// Process deferred application records.
+	if len(a.txnsDeferred) != len(a.recordsDeferred) {
+		return fmt.Errorf("length of deferred txns and records are not equal")
+	}
+	a.log.Debug("exporting deferred application groups", "count", len(a.txnsDeferred))
+	// Transactions are returned newest first, so process deferred groups in reverse.
+	for i := len(a.txnsDeferred)-1; i >= 0; i-- {
+		var (
+			records []exporter.ExportRecord
+			err     error
+		)
+		if a.log.Enabled(exporter.LevelDebug) {
+			for _, r := range a.recordsDeferred[i] {
+				a.log.Debug("deferred record", "index", i, "record", r.String())
+			}
 		}
+		records, err = exporter.NormalizeDeferred(a.log, a.recordsDeferred[i], a.txnsDeferred[i], a.assetMap, a.state.Appl)
 		if err != nil {
-			return records, deferred, err
+			return err
+		}
+		if err := a.writeRecords(records); err != nil {
+			return err
 		}
 	}
+	a.recordsDeferred = nil
+	a.txnsDeferred = nil
+	return nil
+}
 
-	// Other Rewards.
-	if exporter.IsLengthExcludeReward(records, 1) && records[0].IsDeposit() {
-		var err error
-		r := records[0]
-		switch {
-		case r.IsAlgorandGovernance():
-			records, err = exporter.RewardsAlgorandGovernance(records)
-			return records, deferred, err
-		case r.IsAlgoStake():
-			records, err = exporter.RewardsAlgoStake(records)
-			return records, deferred, err
+type exportOptions struct {
+	outDir       string
+	gainsMethod  exporter.LotMethod // Optional realized gains report.
+	prices       exporter.PriceSource
+	currency     string
+	stateFile    string // Optional state file, the export starts from an empty state if not set.
+	stateBackups int
+	workers      int // Number of accounts exported concurrently.
+
+	assetCacheFile string // Optional file the looked up assets are saved to between runs.
+	refreshAssets  assetIDList
+	resume         bool          // Resume the unfinished exports of the state file.
+	window         *exportWindow // Optional stand-alone export of a round or date range.
+	unclassified   bool          // Write the unclassified transactions report.
+	rules          *exporter.Rules
+	log            *exporter.Logger
+}
+
+// exportWindow limits a stand-alone export to a range of rounds and/or days.
+// Dates are UTC days, the end date is included.
+type exportWindow struct {
+	startRound uint64
+	endRound   uint64
+	startDate  time.Time
+	endDate    time.Time
+}
+
+func parseExportWindow(startRound uint64, endRound uint64, startDate string, endDate string) (*exportWindow, error) {
+	if startRound == 0 && endRound == 0 && startDate == "" && endDate == "" {
+		return nil, nil
+	}
+	window := &exportWindow{startRound: startRound, endRound: endRound}
+	var err error
+	if startDate != "" {
+		if window.startDate, err = time.Parse("2006-01-02", startDate); err != nil {
+			return nil, fmt.Errorf("invalid start date %q: %w", startDate, err)
 		}
-		if err != nil {
-			return records, deferred, err
+	}
+	if endDate != "" {
+		if window.endDate, err = time.Parse("2006-01-02", endDate); err != nil {
+			return nil, fmt.Errorf("invalid end date %q: %w", endDate, err)
 		}
 	}
-	
-	// Other dApps.
-	if (exporter.IsLengthExcludeReward(records, 1) && records[0].IsASADeposit()) || (exporter.IsLengthExcludeReward(records, 2) && records[0].IsASAWithdrawal()) {
-		var err error
-		r := records[0]
-		switch {
-		case r.IsAlgomint():
-			records, err = exporter.DAppAlgomint(records, assetMap)
-			return records, deferred, err
+	if endRound != 0 && startRound > endRound {
+		return nil, fmt.Errorf("start round %d is after end round %d", startRound, endRound)
+	}
+	if !window.startDate.IsZero() && !window.endDate.IsZero() && window.startDate.After(window.endDate) {
+		return nil, fmt.Errorf("start date %s is after end date %s", startDate, endDate)
+	}
+	return window, nil
+}
+
+func (w *exportWindow) query() transactionQuery {
+	query := transactionQuery{
+		MinRound: w.startRound,
+		MaxRound: w.endRound,
+	}
+	if query.MinRound == 0 {
+		query.MinRound = 1
+	}
+	if !w.startDate.IsZero() {
+		query.AfterTime = w.startDate.Add(-time.Second)
+	}
+	if !w.endDate.IsZero() {
+		query.BeforeTime = w.endDate.AddDate(0, 0, 1)
+	}
+	return query
+}
+
+// fromStart reports whether the window starts with the account's first round, so it holds the
+// whole history up to its end.
+func (w *exportWindow) fromStart() bool {
+	return w.startRound <= 1 && w.startDate.IsZero()
+}
+
+// fileRange names the files of the export by its dates, or by its rounds without dates.
+func (w *exportWindow) fileRange(startRound uint64, endRound uint64) string {
+	start := strconv.FormatUint(startRound, 10)
+	if !w.startDate.IsZero() {
+		start = w.startDate.Format("2006-01-02")
+	}
+	end := strconv.FormatUint(endRound, 10)
+	if !w.endDate.IsZero() {
+		end = w.endDate.Format("2006-01-02")
+	}
+	return start + "-" + end
+}
+
+func exportAccounts(source transactionSource, export exporter.Interface, accounts accountList, options exportOptions) error {
+	// A range export starts from an empty state, so the lots and the application state miss
+	// everything before the range.
+	if options.window != nil && !options.window.fromStart() {
+		if options.gainsMethod != "" {
+			return fmt.Errorf("a realized gains report needs the lots of the whole account history, " +
+				"leave out the start round and date for a gains report")
 		}
+		options.log.Warn("range export starts with an empty application state, positions opened before the range are missing")
+	}
+	exportState := ExportState{}
+	if options.stateFile != "" {
+		lock, err := lockState(options.stateFile)
 		if err != nil {
-			return records, deferred, err
+			return err
+		}
+		defer lock.unlock()
+		if exportState, err = LoadConfig(options.stateFile); err != nil {
+			return err
+		}
+	}
+	// Assets are shared by all accounts, each account keeps its own assetMap filled from the cache.
+	assets := newAssetCache(source)
+	if options.assetCacheFile != "" {
+		if err := assets.loadAssets(options.assetCacheFile); err != nil {
+			return err
+		}
+		switch {
+		case options.refreshAssets.all:
+			assets.invalidate()
+		case len(options.refreshAssets.assetIDs) > 0:
+			assets.invalidate(options.refreshAssets.assetIDs...)
 		}
 	}
+	source = assets
+
+	workers := options.workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(accounts) {
+		workers = len(accounts)
+	}
 
-	// ASA Airdrops/Rewards are usually done in 1 ASA deposit transaction.
-	if exporter.IsLengthExcludeReward(records, 1) && records[0].IsASADeposit() {
+	options.log.Info("exporting accounts", "count", len(accounts), "workers", workers)
+	// The account states are created up front, so the workers only access their own state.
+	accountStates := make([]*state, len(accounts))
+	for i, accountAddress := range accounts {
+		// accountAddress contains the non-checksummed internal version - String() provides the
+		// version users know - the base32 pubkey w/ checksum
+		accountStates[i] = exportState.ForAccount(export.Name(), accountAddress.String())
+	}
+	var store *stateStore
+	if options.stateFile != "" {
 		var err error
-		records, err = exporter.AirdropASA(records)
-		if err != nil {
-			return records, deferred, err
+		if store, err = newStateStore(options.stateFile, options.stateBackups, exportState); err != nil {
+			return err
 		}
 	}
 
-	// Airdrops/Rewards are usually done in 1 ALGO deposit transaction.
-	if exporter.IsLengthExcludeReward(records, 1) && records[0].IsALGODeposit() {
-		var err error
-		records, err = exporter.AirdropALGO(records)
-		if err != nil {
-			return records, deferred, err
+	errs := make([]error, len(accounts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = exportAccount(source, export, accounts[i].String(), accountStates[i], store, options)
+			}
+		}()
+	}
+	for i := range accounts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// The assets are saved even if an account failed, they are still valid for the next run.
+	if options.assetCacheFile != "" {
+		if err := assets.saveAssets(options.assetCacheFile); err != nil {
+			options.log.Warn("unable to save asset cache", "error", err)
 		}
 	}
 
-	return records, deferred, nil
+	// Report errors in account order, the state of each account was already saved by its worker.
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		options.log.Error("account export failed", "account", accounts[i].String(), "error", err)
+	}
+	return firstErr
 }
 
-func exportAccounts(client *indexer.Client, export exporter.Interface, accounts accountList, outDir string) error {
-	state := LoadConfig()
+// exportAccount exports the transactions of a single account since the last exported round.
+// It can run concurrently with other accounts, so its progress is logged with the account.
+//
+// With a store, the account is checkpointed after each page: the page is saved to the checkpoint
+// directory and the state file records how far the export got. An interrupted export resumes
+// by rebuilding its CSV file from the saved pages, then continues with the next page.
+func exportAccount(source transactionSource, export exporter.Interface, account string, accountState *state, store *stateStore, options exportOptions) error {
+	log := options.log.With("account", account)
 	assetMap := make(map[uint64]models.Asset)
+	startRound := accountState.LastRound + 1
+	query := transactionQuery{MinRound: startRound}
+	if options.window != nil {
+		query = options.window.query()
+		startRound = query.MinRound
+	}
+	// fileRange names the files of the export.
+	fileRange := func(startRound uint64, endRound uint64) string {
+		if options.window != nil {
+			return options.window.fileRange(startRound, endRound)
+		}
+		return fmt.Sprintf("%d-%d", startRound, endRound)
+	}
 
-	fmt.Println("Exporting accounts:")
-	for _, accountAddress := range accounts {
-		// accountAddress contains the non-checksummed internal version - String() provides the
-		// version users know - the base32 pubkey w/ checksum
-		account := accountAddress.String()
-
-		startRound := state.ForAccount(export.Name(), account).LastRound + 1
-		fmt.Println(account, "starting at:", startRound)
-
-		var txnsGroup []models.Transaction
-		var records []exporter.ExportRecord
-		var recordsDeferred [][]exporter.ExportRecord
-		var txnsDeferred [][]models.Transaction
-		var outCsv *os.File
-
-		nextToken := ""
-		numPages := 1
-		for {
-			lookupTx := client.LookupAccountTransactions(account)
-			lookupTx.MinRound(startRound)
-			lookupTx.NextToken(nextToken)
-			transactions, err := lookupTx.Do(context.TODO())
+	var (
+		accountExport   *accountExport
+		outCsv          *os.File
+		unclassifiedCsv *os.File
+		endRound        uint64
+		checkpointDir   string
+	)
+	defer func() {
+		if outCsv != nil {
+			outCsv.Close()
+		}
+		if unclassifiedCsv != nil {
+			unclassifiedCsv.Close()
+		}
+	}()
+	if store != nil {
+		checkpointDir = checkpointDirFor(store.file, export.Name(), account)
+	}
+	// startExport creates the CSV file, truncating the partial file of an interrupted export.
+	startExport := func() error {
+		var err error
+		outCsv, err = os.Create(filepath.Join(options.outDir, fmt.Sprintf("%s-%s-%s.csv", export.Name(), account, fileRange(startRound, endRound))))
+		if err != nil {
+			return fmt.Errorf("unable to create file: %w", err)
+		}
+		export.WriteHeader(outCsv)
+		accountExport = newAccountExport(log, source, export, account, assetMap, accountState, outCsv)
+		if options.prices != nil {
+			accountExport.priceRecords(options.prices, options.currency)
+		}
+		// The lots only hold the whole history of the account if they were updated on every run.
+		switch {
+		case accountState.LotsRound == accountState.LastRound:
+			accountExport.trackGains(options.prices)
+		case options.gainsMethod != "":
+			return fmt.Errorf("the realized gains lots are built to round %d but the account was exported to round %d, "+
+				"export the account again with a new state file for a gains report", accountState.LotsRound, accountState.LastRound)
+		}
+		accountExport.rules = options.rules
+		if options.unclassified {
+			unclassifiedCsv, err = os.Create(filepath.Join(options.outDir, fmt.Sprintf("%s-unclassified-%s-%s.csv", export.Name(), account, fileRange(startRound, endRound))))
 			if err != nil {
-				return fmt.Errorf("error looking up transactions: %w", err)
+				return fmt.Errorf("unable to create file: %w", err)
 			}
-			endRound := transactions.CurrentRound
-			if numPages == 1 {
-				state.ForAccount(export.Name(), account).LastRound = endRound
-				outCsv, err = os.Create(filepath.Join(outDir, fmt.Sprintf("%s-%s-%d-%d.csv", export.Name(), account, startRound, endRound)))
-				if err != nil {
-					return fmt.Errorf("unable to create file: %w", err)
-				}
-				export.WriteHeader(outCsv)
+			accountExport.unclassified = exporter.NewUnclassifiedReport(unclassifiedCsv)
+		}
+		return nil
+	}
+	addTransactions := func(transactions []models.Transaction) error {
+		for _, tx := range transactions {
+			if !query.matches(tx) {
+				continue
+			}
+			if err := accountExport.addTransaction(tx); err != nil {
+				return err
 			}
+		}
+		return nil
+	}
 
-			numTx := len(transactions.Transactions)
-			fmt.Printf("  %v transactions\n", numTx)
-			if numTx == 0 {
-				break
+	nextToken := ""
+	numPages := 1
+	if checkpoint := accountState.Checkpoint; checkpoint != nil && store != nil && options.resume {
+		startRound, endRound = checkpoint.StartRound, checkpoint.EndRound
+		query.MinRound = startRound
+		log.Info("resuming export", "page", checkpoint.Pages+1, "after_round", checkpoint.Round, "start_round", startRound)
+		if err := startExport(); err != nil {
+			return err
+		}
+		for page := 1; page <= checkpoint.Pages; page++ {
+			var dump dumpPage
+			if err := readJSONFile(checkpointPageFile(checkpointDir, page), &dump); err != nil {
+				return fmt.Errorf("unable to resume from checkpoint page %d, remove the checkpoint from the state file to start over: %w", page, err)
 			}
+			if err := addTransactions(dump.Response.Transactions); err != nil {
+				return err
+			}
+		}
+		nextToken = checkpoint.NextToken
+		numPages = checkpoint.Pages + 1
+	} else {
+		accountState.Checkpoint = nil
+		log.Info("starting export", "start_round", startRound)
+	}
 
-			for _, tx := range transactions.Transactions {
-				// Transaction is in same group.
-				if len(txnsGroup) > 0 && len(tx.Group) > 0 && bytes.Equal(tx.Group, txnsGroup[0].Group) {
-					txnsGroup = append(txnsGroup, tx)
-					continue
+	for {
+		transactions, err := source.LookupAccountTransactions(account, query, nextToken)
+		if err != nil {
+			return err
+		}
+		if accountExport == nil {
+			endRound = transactions.CurrentRound
+			if query.MaxRound != 0 && query.MaxRound < endRound {
+				endRound = query.MaxRound
+			}
+			if err := startExport(); err != nil {
+				return err
+			}
+			if store != nil {
+				// Checkpoint the export window right away, so a restart writes to the same CSV file.
+				if err := os.RemoveAll(checkpointDir); err != nil {
+					return fmt.Errorf("unable to reset checkpoint: %w", err)
 				}
-				var deferred bool
-				// Current transaction is in different group, so export previous transaction group.
-				records, deferred, err = normalizeTransactions(client, export, account, assetMap, "", txnsGroup)
-				if err != nil {
+				accountState.Checkpoint = &checkpoint{StartRound: startRound, EndRound: endRound}
+				if err := store.save(export.Name(), account, accountState); err != nil {
 					return err
 				}
-				if deferred {
-					recordsDeferred = append(recordsDeferred, records)
-					txnsDeferred = append(txnsDeferred, txnsGroup)
-				} else {
-					writeRecords(export, outCsv, assetMap, records)
-				}
-
-				records = nil
-				txnsGroup = nil // Reset group.
-				txnsGroup = append(txnsGroup, tx)
 			}
+		}
 
-			fmt.Printf("  %v NextToken at Page %d\n", transactions.NextToken, numPages)
-			nextToken = transactions.NextToken
-			numPages++
+		numTx := len(transactions.Transactions)
+		log.Info("fetched transactions", "page", numPages, "count", numTx)
+		if numTx == 0 {
+			break
+		}
 
-			// Rate limited to <1 request per second.
-			time.Sleep(2 * time.Second)
+		if err := addTransactions(transactions.Transactions); err != nil {
+			return err
 		}
-		// Export final transaction(s).
-		if len(txnsGroup) > 0 {
-			records, deferred, err := normalizeTransactions(client, export, account, assetMap, "", txnsGroup)
-			if err != nil {
-				return err
+
+		if store != nil {
+			page := dumpPage{
+				transactionQuery: query,
+				NextToken:        nextToken,
+				Response:         transactions,
 			}
-			if deferred {
-				recordsDeferred = append(recordsDeferred, records)
-				txnsDeferred = append(txnsDeferred, txnsGroup)
-			} else {
-				writeRecords(export, outCsv, assetMap, records)
+			if err := writeJSONFile(checkpointPageFile(checkpointDir, numPages), page); err != nil {
+				return fmt.Errorf("unable to save checkpoint: %w", err)
 			}
-		}
-		records = nil
-		txnsGroup = nil
-
-		// Process deferred AlgoFi records.
-		if len(txnsDeferred) != len(recordsDeferred) {
-			return fmt.Errorf("length of deferred txns and records are not equal")
-		}
-		fmt.Printf("Deferred AlgoFi Transactions %d\n", len(txnsDeferred))
-		for i := len(txnsDeferred)-1; i >= 0; i-- {
-			var err error
-			fmt.Printf("  Group %d\n", i)
-			for _, r := range recordsDeferred[i] {
-				fmt.Printf("    %s\n", r.String())
+			accountState.Checkpoint = &checkpoint{
+				StartRound: startRound,
+				EndRound:   endRound,
+				NextToken:  transactions.NextToken,
+				Pages:      numPages,
+				Round:      accountExport.lastRound,
+				Group:      accountExport.lastGroup,
 			}
-			records, state.ForAccount(export.Name(), account).AlgoFi, err = exporter.ApplAlgoFiLend(recordsDeferred[i], txnsDeferred[i], assetMap, state.ForAccount(export.Name(), account).AlgoFi)
-			if err != nil {
+			if err := store.save(export.Name(), account, accountState); err != nil {
 				return err
 			}
-			writeRecords(export, outCsv, assetMap, records)
-			records = nil
+		}
+
+		log.Debug("next page", "page", numPages, "next_token", transactions.NextToken)
+		nextToken = transactions.NextToken
+		numPages++
+	}
+	if err := accountExport.finish(); err != nil {
+		return err
+	}
+	accountExport.missingPrices.Log(log, assetMap)
+	if accountExport.gains != nil {
+		accountExport.processGains(endRound)
+	}
+	if options.gainsMethod != "" {
+		gainsCsv, err := os.Create(filepath.Join(options.outDir, fmt.Sprintf("%s-gains-%s-%s-%s.csv", export.Name(), options.gainsMethod, account, fileRange(startRound, endRound))))
+		if err != nil {
+			return fmt.Errorf("unable to create file: %w", err)
+		}
+		err = accountExport.writeGains(options.gainsMethod, gainsCsv)
+		gainsCsv.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if accountExport.unclassified != nil && accountExport.unclassified.Len() > 0 {
+		log.Warn("transaction groups could not be classified, see the unclassified report", "groups", accountExport.unclassified.Len())
+	}
+	log.Info("exported account", "end_round", endRound)
+
+	// The export is complete, the next run starts after it.
+	accountState.LastRound = endRound
+	accountState.Checkpoint = nil
+	if store != nil {
+		if err := store.save(export.Name(), account, accountState); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(checkpointDir); err != nil {
+			return fmt.Errorf("unable to remove checkpoint: %w", err)
 		}
 	}
-	state.SaveConfig()
 	return nil
 }
 
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := newRateLimiter(2, 2)
+	now := l.last
+
+	// The burst is available immediately, then requests are spaced 1/rate apart.
+	want := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := l.reserve(now); got != w {
+			t.Errorf("request %d: got wait %v, want %v", i, got, w)
+		}
+	}
+
+	// Waiting refills the bucket, but never above the burst.
+	if got := l.reserve(now.Add(10 * time.Second)); got != 0 {
+		t.Errorf("after refill: got wait %v, want 0", got)
+	}
+	if l.tokens != 1 {
+		t.Errorf("tokens: got %v, want 1", l.tokens)
+	}
+}
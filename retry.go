@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/m4dc0w/algo-export/exporter"
+)
+
+const (
+	defaultRetries   = 5
+	defaultRetryWait = time.Second
+	maxRetryWait     = time.Minute
+)
+
+// httpStatusError is a retryable HTTP response.
+type httpStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // Zero if the response had no Retry-After header.
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header, given in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// statusTransport returns retryable HTTP responses as *httpStatusError errors.
+// The SDK clients drop the headers of failed responses, so this is the only place Retry-After is seen.
+type statusTransport struct {
+	base *http.Transport
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || !retryableStatus(resp.StatusCode) {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, &httpStatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+// installStatusTransport wraps http.DefaultTransport, which the SDK clients always use, in a statusTransport.
+func installStatusTransport() {
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		http.DefaultTransport = &statusTransport{base: transport}
+	}
+}
+
+// retryable reports whether err is worth retrying, and how long the server asked us to wait.
+// Only timeouts, dropped connections and retryable HTTP statuses are retried, a TLS or DNS
+// failure would fail again.
+func retryable(err error) (bool, time.Duration) {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.StatusCode), statusErr.RetryAfter
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true, 0
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true, 0
+	}
+	return false, 0
+}
+
+// retryBudget limits the total number of retries of a run, shared by all accounts,
+// so an unavailable service fails the run instead of retrying every request.
+type retryBudget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+func newRetryBudget(retries int) *retryBudget {
+	return &retryBudget{remaining: retries}
+}
+
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// retrySource retries the failed requests of a transactionSource with exponential backoff and jitter.
+// A page is retried with the same NextToken, so a failure never restarts the export of an account.
+type retrySource struct {
+	transactionSource
+	retries int // Retries of a single request.
+	wait    time.Duration
+	budget  *retryBudget
+	sleep   func(time.Duration)
+	log     *exporter.Logger
+}
+
+func newRetrySource(source transactionSource, retries int, wait time.Duration, budget *retryBudget, log *exporter.Logger) *retrySource {
+	return &retrySource{
+		transactionSource: source,
+		retries:           retries,
+		wait:              wait,
+		budget:            budget,
+		sleep:             time.Sleep,
+		log:               log,
+	}
+}
+
+// backoff returns the wait before retry attempt (0 based): wait doubled for each attempt up to
+// maxRetryWait, with jitter so concurrent workers do not retry in lockstep, or retryAfter if longer.
+func (s *retrySource) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	wait := s.wait
+	for i := 0; i < attempt && wait < maxRetryWait; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	if retryAfter > wait {
+		return retryAfter
+	}
+	return wait
+}
+
+func (s *retrySource) do(request string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		ok, retryAfter := retryable(err)
+		if !ok {
+			return err
+		}
+		if attempt >= s.retries {
+			return fmt.Errorf("giving up on %s after %d retries: %w", request, attempt, err)
+		}
+		if !s.budget.take() {
+			return fmt.Errorf("giving up on %s, retry budget exhausted: %w", request, err)
+		}
+		wait := s.backoff(attempt, retryAfter)
+		s.log.Warn("retrying request", "request", request, "attempt", attempt+1, "wait", wait.Round(time.Millisecond), "error", err)
+		s.sleep(wait)
+	}
+}
+
+func (s *retrySource) LookupAccountTransactions(account string, query transactionQuery, nextToken string) (models.TransactionsResponse, error) {
+	var transactions models.TransactionsResponse
+	err := s.do(fmt.Sprintf("transactions of %s", account), func() error {
+		var err error
+		transactions, err = s.transactionSource.LookupAccountTransactions(account, query, nextToken)
+		return err
+	})
+	return transactions, err
+}
+
+func (s *retrySource) LookupAssetByID(assetID uint64) (models.Asset, error) {
+	var asset models.Asset
+	err := s.do(fmt.Sprintf("asset %d", assetID), func() error {
+		var err error
+		asset, err = s.transactionSource.LookupAssetByID(assetID)
+		return err
+	})
+	return asset, err
+}
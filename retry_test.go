@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyIndexer serves the given HTTP statuses in turn, and a page of transactions once they run out.
+func flakyIndexer(statuses ...int) (*httptest.Server, *[]string) {
+	var nextTokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextTokens = append(nextTokens, r.URL.Query().Get("next"))
+		if len(statuses) > 0 {
+			status := statuses[0]
+			statuses = statuses[1:]
+			if status == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", "7")
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		fmt.Fprint(w, `{"current-round": 10, "next-token": "page-3", "transactions": [{"id": "TX", "confirmed-round": 5}]}`)
+	}))
+	return server, &nextTokens
+}
+
+func newTestRetrySource(t *testing.T, server *httptest.Server, budget int) (*retrySource, *[]time.Duration) {
+	source, err := newEndpointSource(endpointProfile{Type: endpointIndexer, URL: server.URL}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var waits []time.Duration
+	retry := newRetrySource(source, 3, time.Second, newRetryBudget(budget), nil)
+	retry.sleep = func(wait time.Duration) { waits = append(waits, wait) }
+	return retry, &waits
+}
+
+func TestRetrySource(t *testing.T) {
+	defer func(transport http.RoundTripper) { http.DefaultTransport = transport }(http.DefaultTransport)
+	installStatusTransport()
+
+	server, nextTokens := flakyIndexer(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer server.Close()
+	source, waits := newTestRetrySource(t, server, 10)
+	transactions, err := source.LookupAccountTransactions("ACCOUNT", transactionQuery{}, "page-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions.Transactions) != 1 || transactions.NextToken != "page-3" {
+		t.Errorf("got %d transactions, next token %q", len(transactions.Transactions), transactions.NextToken)
+	}
+	// Every attempt asks for the same page.
+	if strings.Join(*nextTokens, ",") != "page-2,page-2,page-2" {
+		t.Errorf("next tokens: got %v", *nextTokens)
+	}
+	if len(*waits) != 2 {
+		t.Fatalf("waits: got %v, want 2", *waits)
+	}
+	if (*waits)[0] != 7*time.Second {
+		t.Errorf("first wait: got %v, want the Retry-After of 7s", (*waits)[0])
+	}
+	if (*waits)[1] < time.Second || (*waits)[1] > 2*time.Second {
+		t.Errorf("second wait: got %v, want 1s to 2s", (*waits)[1])
+	}
+}
+
+func TestRetrySourceGivesUp(t *testing.T) {
+	defer func(transport http.RoundTripper) { http.DefaultTransport = transport }(http.DefaultTransport)
+	installStatusTransport()
+
+	for _, test := range []struct {
+		name     string
+		statuses []int
+		budget   int
+		requests int
+		err      string
+	}{
+		{"not retryable", []int{http.StatusNotFound}, 10, 1, "HTTP 404"},
+		{"retries", []int{500, 502, 504, 500, 500}, 10, 4, "after 3 retries"},
+		{"budget", []int{500, 502, 504, 500, 500}, 1, 2, "retry budget exhausted"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server, nextTokens := flakyIndexer(test.statuses...)
+			defer server.Close()
+			source, _ := newTestRetrySource(t, server, test.budget)
+			_, err := source.LookupAccountTransactions("ACCOUNT", transactionQuery{}, "")
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+			if len(*nextTokens) != test.requests {
+				t.Errorf("requests: got %d, want %d", len(*nextTokens), test.requests)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", &url.Error{Op: "Get", URL: "https://indexer", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}, true},
+		{"connection reset", &url.Error{Op: "Get", URL: "https://indexer",
+			Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"unexpected EOF", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), true},
+		{"HTTP status", &httpStatusError{StatusCode: http.StatusBadGateway}, true},
+		{"DNS", &url.Error{Op: "Get", URL: "https://indexer", Err: &net.DNSError{Err: "no such host", Name: "indexer", IsNotFound: true}}, false},
+		{"TLS", &url.Error{Op: "Get", URL: "https://indexer", Err: x509.UnknownAuthorityError{}}, false},
+		{"other", fmt.Errorf("invalid response"), false},
+	} {
+		if got, _ := retryable(test.err); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"-1":                            0,
+		"Sat, 01 Jan 2022 00:01:00 GMT": time.Minute,
+		"Fri, 31 Dec 2021 00:00:00 GMT": 0,
+		"soon":                          0,
+	} {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("%q: got %v, want %v", value, got, want)
+		}
+	}
+}
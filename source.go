@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/algorand/go-algorand-sdk/client/v2/indexer"
+)
+
+// transactionQuery selects the account transactions to look up.
+// MinRound and MaxRound are inclusive, AfterTime and BeforeTime are exclusive.
+type transactionQuery struct {
+	MinRound   uint64
+	MaxRound   uint64    `json:",omitempty"` // 0 for no limit.
+	AfterTime  time.Time // Zero for no limit.
+	BeforeTime time.Time // Zero for no limit.
+}
+
+// matches reports whether tx is within the query, for sources which do not filter themselves.
+func (q transactionQuery) matches(tx models.Transaction) bool {
+	roundTime := time.Unix(int64(tx.RoundTime), 0)
+	switch {
+	case tx.ConfirmedRound < q.MinRound:
+		return false
+	case q.MaxRound != 0 && tx.ConfirmedRound > q.MaxRound:
+		return false
+	case !q.AfterTime.IsZero() && !roundTime.After(q.AfterTime):
+		return false
+	case !q.BeforeTime.IsZero() && !roundTime.Before(q.BeforeTime):
+		return false
+	}
+	return true
+}
+
+// transactionSource provides the account transactions and asset lookups used by exportAccounts.
+type transactionSource interface {
+	// LookupAccountTransactions returns a single page of transactions for account matching query.
+	LookupAccountTransactions(account string, query transactionQuery, nextToken string) (models.TransactionsResponse, error)
+	// LookupAssetByID returns the asset (ASA) details for assetID.
+	LookupAssetByID(assetID uint64) (models.Asset, error)
+}
+
+// indexerSource looks up transactions and assets from an indexer.
+// All requests share the limiter, so concurrent account exports stay within the provider's rate limit.
+type indexerSource struct {
+	client  *indexer.Client
+	limiter *rateLimiter
+}
+
+func newIndexerSource(client *indexer.Client, limiter *rateLimiter) *indexerSource {
+	return &indexerSource{client: client, limiter: limiter}
+}
+
+func (s *indexerSource) LookupAccountTransactions(account string, query transactionQuery, nextToken string) (models.TransactionsResponse, error) {
+	s.limiter.Wait()
+	lookupTx := s.client.LookupAccountTransactions(account)
+	lookupTx.MinRound(query.MinRound)
+	if query.MaxRound != 0 {
+		lookupTx.MaxRound(query.MaxRound)
+	}
+	if !query.AfterTime.IsZero() {
+		lookupTx.AfterTime(query.AfterTime)
+	}
+	if !query.BeforeTime.IsZero() {
+		lookupTx.BeforeTime(query.BeforeTime)
+	}
+	lookupTx.NextToken(nextToken)
+	transactions, err := lookupTx.Do(context.TODO())
+	if err != nil {
+		return transactions, fmt.Errorf("error looking up transactions: %w", err)
+	}
+	return transactions, nil
+}
+
+func (s *indexerSource) LookupAssetByID(assetID uint64) (models.Asset, error) {
+	s.limiter.Wait()
+	_, asset, err := s.client.LookupAssetByID(assetID).Do(context.TODO())
+	if err != nil {
+		return asset, fmt.Errorf("error looking up asset id: %w", err)
+	}
+	return asset, nil
+}
+
+// assetCache wraps a transactionSource and looks up each asset only once.
+// It is safe for concurrent use, concurrent lookups of the same asset wait for the first one.
+type assetCache struct {
+	transactionSource
+
+	mu     sync.Mutex
+	assets map[uint64]*cachedAsset
+}
+
+type cachedAsset struct {
+	done  chan struct{}
+	asset models.Asset
+	err   error
+}
+
+func newAssetCache(source transactionSource) *assetCache {
+	return &assetCache{
+		transactionSource: source,
+		assets:            map[uint64]*cachedAsset{},
+	}
+}
+
+// loadAssets adds the assets saved by saveAssets to the cache. A missing file is an empty cache.
+func (c *assetCache) loadAssets(file string) error {
+	if !fileExist(file) {
+		return nil
+	}
+	var assets map[uint64]models.Asset
+	if err := readJSONFile(file, &assets); err != nil {
+		return fmt.Errorf("unable to read asset cache %s: %w", file, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for assetID, asset := range assets {
+		cached := &cachedAsset{done: make(chan struct{}), asset: asset}
+		close(cached.done)
+		c.assets[assetID] = cached
+	}
+	return nil
+}
+
+// saveAssets saves every successfully looked up asset.
+func (c *assetCache) saveAssets(file string) error {
+	c.mu.Lock()
+	assets := map[uint64]models.Asset{}
+	var pending []*cachedAsset
+	for assetID, cached := range c.assets {
+		select {
+		case <-cached.done:
+			if cached.err == nil {
+				assets[assetID] = cached.asset
+			}
+		default:
+			pending = append(pending, cached)
+		}
+	}
+	c.mu.Unlock()
+	if len(pending) > 0 {
+		return fmt.Errorf("unable to save asset cache with %d lookups in progress", len(pending))
+	}
+	// Written atomically, so an interrupted run never leaves a truncated cache for the next one.
+	data, err := json.MarshalIndent(assets, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(file, data)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save asset cache %s: %w", file, err)
+	}
+	return nil
+}
+
+// invalidate removes assetIDs from the cache, or every asset if assetIDs is empty,
+// so they are looked up again (e.g. after the asset was reconfigured).
+func (c *assetCache) invalidate(assetIDs ...uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(assetIDs) == 0 {
+		c.assets = map[uint64]*cachedAsset{}
+		return
+	}
+	for _, assetID := range assetIDs {
+		delete(c.assets, assetID)
+	}
+}
+
+func (c *assetCache) LookupAssetByID(assetID uint64) (models.Asset, error) {
+	c.mu.Lock()
+	cached, ok := c.assets[assetID]
+	if ok {
+		c.mu.Unlock()
+		<-cached.done
+		return cached.asset, cached.err
+	}
+	cached = &cachedAsset{done: make(chan struct{})}
+	c.assets[assetID] = cached
+	c.mu.Unlock()
+
+	cached.asset, cached.err = c.transactionSource.LookupAssetByID(assetID)
+	if cached.err != nil {
+		// Allow a later lookup to retry.
+		c.mu.Lock()
+		if c.assets[assetID] == cached {
+			delete(c.assets, assetID)
+		}
+		c.mu.Unlock()
+	}
+	close(cached.done)
+	return cached.asset, cached.err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+// countingSource counts the asset lookups that reach the wrapped source.
+type countingSource struct {
+	fixtureSource
+	lookups int32
+}
+
+func (s *countingSource) LookupAssetByID(assetID uint64) (models.Asset, error) {
+	atomic.AddInt32(&s.lookups, 1)
+	return s.fixtureSource.LookupAssetByID(assetID)
+}
+
+func TestAssetCacheConcurrent(t *testing.T) {
+	source := &countingSource{fixtureSource: fixtureSource{assets: map[uint64]models.Asset{
+		31566704: {Index: 31566704},
+	}}}
+	cache := newAssetCache(source)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			asset, err := cache.LookupAssetByID(31566704)
+			if err != nil || asset.Index != 31566704 {
+				t.Errorf("got asset %d, err %v", asset.Index, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if source.lookups != 1 {
+		t.Errorf("lookups: got %d, want 1", source.lookups)
+	}
+
+	// Failed lookups are not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := cache.LookupAssetByID(1); err == nil {
+			t.Error("expected an error for an unknown asset")
+		}
+	}
+	if source.lookups != 3 {
+		t.Errorf("lookups: got %d, want 3", source.lookups)
+	}
+}
+
+func TestAssetCachePersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "assets.json")
+
+	source := &countingSource{fixtureSource: fixtureSource{assets: map[uint64]models.Asset{
+		31566704: {Index: 31566704},
+		312769:   {Index: 312769},
+	}}}
+	cache := newAssetCache(source)
+	if err := cache.loadAssets(file); err != nil {
+		t.Fatal(err)
+	}
+	for _, assetID := range []uint64{31566704, 312769} {
+		if _, err := cache.LookupAssetByID(assetID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.saveAssets(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new run uses the saved assets, except for the invalidated ones.
+	cache = newAssetCache(source)
+	if err := cache.loadAssets(file); err != nil {
+		t.Fatal(err)
+	}
+	cache.invalidate(312769)
+	for _, assetID := range []uint64{31566704, 312769} {
+		if _, err := cache.LookupAssetByID(assetID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if source.lookups != 3 {
+		t.Errorf("lookups: got %d, want 3", source.lookups)
+	}
+}
@@ -2,18 +2,41 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/m4dc0w/algo-export/exporter"
 )
 
-func stateFile() string {
+// stateVersion is the current schema version of the state file.
+// Bump it and add a migration to stateMigrations whenever the saved state changes shape.
+const stateVersion = 3
+
+// defaultStateFile is the state file used when no -state path is given.
+func defaultStateFile() string {
 	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, fmt.Sprintf("algo-csv-state.json"))
+	return filepath.Join(homeDir, "algo-csv-state.json")
+}
+
+// assetCacheFile is the asset (ASA) cache saved next to the state file.
+func assetCacheFile(stateFile string) string {
+	return filepath.Join(filepath.Dir(stateFile), "algo-csv-assets.json")
+}
+
+// checkpointDirFor holds the pages of the unfinished export of account, next to the state file.
+func checkpointDirFor(stateFile string, format string, account string) string {
+	return filepath.Join(filepath.Dir(stateFile), "algo-csv-checkpoints", format+"-"+account)
+}
+
+func checkpointPageFile(dir string, page int) string {
+	return filepath.Join(dir, fmt.Sprintf("page-%d.json", page))
 }
 
 // ExportState is the root type we use to persist state for the formats/accounts
@@ -25,31 +48,131 @@ type AccountExportState map[string]*state
 
 type state struct {
 	LastRound uint64
-	AlgoFi    exporter.AlgoFiState
+	Appl      exporter.ApplState
+	Lots      map[exporter.LotMethod]exporter.Lots `json:",omitempty"`
+	// LotsRound is the last round included in Lots, behind LastRound if the lots missed exports.
+	LotsRound uint64 `json:",omitempty"`
+
+	// Checkpoint is the progress of an unfinished export, saved after each page.
+	Checkpoint *checkpoint `json:",omitempty"`
+
+	// AlgoFi is the AlgoFi state saved before application handlers had their own state.
+	AlgoFi json.RawMessage `json:",omitempty"`
+}
+
+// checkpoint is an unfinished export of an account.
+// The pages exported so far are saved in the checkpoint directory, so a later run rebuilds the
+// same CSV file from them and continues paging from NextToken.
+type checkpoint struct {
+	StartRound uint64
+	EndRound   uint64
+	NextToken  string
+	Pages      int
+
+	// Round and Group of the last fully processed transaction group.
+	Round uint64
+	Group []byte `json:",omitempty"`
 }
 
 func newState() *state {
 	return &state{
-		AlgoFi: exporter.AlgoFiState{},
+		Appl: exporter.ApplState{},
+	}
+}
+
+// stateFileData is the saved state file.
+// Version 0 files have no version and hold the ExportState at the root.
+type stateFileData struct {
+	Version int
+	Formats ExportState
+}
+
+// stateMigrations upgrade the state file from version i to version i+1.
+var stateMigrations = []func(data *stateFileData) error{
+	// 0 -> 1: application handlers keep their own state, move the AlgoFi state into it.
+	func(data *stateFileData) error {
+		for _, accountStates := range data.Formats {
+			for _, accountState := range accountStates {
+				if accountState.Appl == nil {
+					accountState.Appl = exporter.ApplState{}
+				}
+				if accountState.AlgoFi != nil {
+					accountState.Appl[exporter.AlgoFiStateName] = accountState.AlgoFi
+					accountState.AlgoFi = nil
+				}
+			}
+		}
+		return nil
+	},
+	// 1 -> 2: the AlgoFi state is keyed by market instead of a field per asset.
+	func(data *stateFileData) error {
+		for _, accountStates := range data.Formats {
+			for account, accountState := range accountStates {
+				if err := exporter.MigrateAlgoFiState(accountState.Appl); err != nil {
+					return fmt.Errorf("account %s: %w", account, err)
+				}
+			}
+		}
+		return nil
+	},
+	// 2 -> 3: the lots record the round they are built to. Lots saved before are assumed to be up to date,
+	// an account without lots has exported rounds missing from them.
+	func(data *stateFileData) error {
+		for _, accountStates := range data.Formats {
+			for _, accountState := range accountStates {
+				if len(accountState.Lots) > 0 {
+					accountState.LotsRound = accountState.LastRound
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// parseStateFile parses a state file of any version and migrates it to the current version.
+func parseStateFile(configBytes []byte) (ExportState, error) {
+	var versioned struct {
+		Version *int
 	}
+	if err := json.Unmarshal(configBytes, &versioned); err != nil {
+		return nil, err
+	}
+	data := stateFileData{Formats: ExportState{}}
+	if versioned.Version == nil {
+		if err := json.Unmarshal(configBytes, &data.Formats); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(configBytes, &data); err != nil {
+		return nil, err
+	}
+	if data.Version > stateVersion {
+		return nil, fmt.Errorf("state file version %d is newer than the supported version %d", data.Version, stateVersion)
+	}
+	for ; data.Version < stateVersion; data.Version++ {
+		if err := stateMigrations[data.Version](&data); err != nil {
+			return nil, fmt.Errorf("migrating from version %d: %w", data.Version, err)
+		}
+	}
+	if data.Formats == nil {
+		data.Formats = ExportState{}
+	}
+	return data.Formats, nil
 }
 
-// LoadConfig hande
-func LoadConfig() ExportState {
-	var retState = ExportState{}
-	configFile := stateFile()
+// LoadConfig loads the state file, an empty state is returned if it does not exist yet.
+func LoadConfig(configFile string) (ExportState, error) {
 	if !fileExist(configFile) {
-		return retState
+		return ExportState{}, nil
 	}
 	configBytes, err := ioutil.ReadFile(configFile)
 	if err != nil {
-		log.Fatalln("reading config file:", configFile, "error:", err)
+		return nil, fmt.Errorf("reading config file: %s error: %w", configFile, err)
 	}
-	err = json.Unmarshal(configBytes, &retState)
+	retState, err := parseStateFile(configBytes)
 	if err != nil {
-		log.Fatalln("parsing config file:", configFile, "error:", err)
+		return nil, fmt.Errorf("parsing config file: %s error: %w", configFile, err)
 	}
-	return retState
+	return retState, nil
 }
 
 func (s ExportState) ForAccount(format string, account string) *state {
@@ -64,11 +187,191 @@ func (s ExportState) ForAccount(format string, account string) *state {
 	return s[format][account]
 }
 
-func (s ExportState) SaveConfig() {
-	data, err := json.MarshalIndent(s, "", "  ")
+// SaveConfig replaces the state file atomically, keeping the previous backups versions of it
+// as <file>.1 (the most recent) to <file>.<backups>.
+func (s ExportState) SaveConfig(configFile string, backups int) error {
+	return saveStateFile(configFile, backups, s)
+}
+
+// saveStateFile saves the formats (an ExportState or its marshalled accounts) as the current version.
+func saveStateFile(configFile string, backups int, formats interface{}) error {
+	data, err := json.MarshalIndent(struct {
+		Version int
+		Formats interface{}
+	}{stateVersion, formats}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling state: %w", err)
+	}
+	if err := backupFile(configFile, backups); err != nil {
+		return fmt.Errorf("unable to back up state file %s: %w", configFile, err)
+	}
+	if err := writeFileAtomic(configFile, data); err != nil {
+		return fmt.Errorf("unable to save state file %s: %w", configFile, err)
+	}
+	return nil
+}
+
+// stateStore saves the state file while accounts are exported concurrently.
+// Each account is saved as a snapshot marshalled by its own worker, so saving never reads
+// the state of an account that is still being exported.
+type stateStore struct {
+	mu       sync.Mutex
+	file     string
+	backups  int
+	backedUp bool
+	formats  map[string]map[string]json.RawMessage
+}
+
+func newStateStore(file string, backups int, exportState ExportState) (*stateStore, error) {
+	store := &stateStore{
+		file:    file,
+		backups: backups,
+		formats: map[string]map[string]json.RawMessage{},
+	}
+	for format, accountStates := range exportState {
+		store.formats[format] = map[string]json.RawMessage{}
+		for account, accountState := range accountStates {
+			data, err := json.Marshal(accountState)
+			if err != nil {
+				return nil, fmt.Errorf("error marshalling state: %w", err)
+			}
+			store.formats[format][account] = data
+		}
+	}
+	return store, nil
+}
+
+// save saves the state of a single account. Only the first save of a run is backed up,
+// so the backups are not replaced by the checkpoints of a single run.
+func (s *stateStore) save(format string, account string, accountState *state) error {
+	data, err := json.Marshal(accountState)
 	if err != nil {
-		log.Println("error mashalling address data:", err)
-		os.Exit(1)
+		return fmt.Errorf("error marshalling state: %w", err)
 	}
-	_ = ioutil.WriteFile(stateFile(), data, 0644)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.formats[format]; !ok {
+		s.formats[format] = map[string]json.RawMessage{}
+	}
+	s.formats[format][account] = data
+	backups := s.backups
+	if s.backedUp {
+		backups = 0
+	}
+	if err := saveStateFile(s.file, backups, s.formats); err != nil {
+		return err
+	}
+	s.backedUp = true
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and renames it over file,
+// so file is never left half written.
+func writeFileAtomic(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// backupFile rotates <file>.1 .. <file>.<backups> and copies file to <file>.1.
+func backupFile(file string, backups int) error {
+	if backups < 1 || !fileExist(file) {
+		return nil
+	}
+	backupName := func(n int) string { return file + "." + strconv.Itoa(n) }
+	for n := backups - 1; n >= 1; n-- {
+		if !fileExist(backupName(n)) {
+			continue
+		}
+		if err := os.Rename(backupName(n), backupName(n+1)); err != nil {
+			return err
+		}
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(backupName(1), data)
+}
+
+// stateLock prevents two runs from using the same state file at the same time.
+type stateLock struct {
+	file string
+}
+
+// lockState creates the <file>.lock lock file holding the PID of the run, failing if another run holds it.
+// The lock of a run which was interrupted (e.g. killed or crashed) is stale once its process is gone, and is taken over.
+func lockState(file string) (*stateLock, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	lockFile := file + ".lock"
+	f, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) && staleLock(lockFile) {
+		if err := os.Remove(lockFile); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("unable to remove stale lock %s: %w", lockFile, err)
+		}
+		f, err = os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("state file %s is in use by another run, remove %s if that run is no longer active", file, lockFile)
+		}
+		return nil, fmt.Errorf("unable to lock state file %s: %w", file, err)
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	if err := f.Close(); err != nil {
+		os.Remove(lockFile)
+		return nil, fmt.Errorf("unable to lock state file %s: %w", file, err)
+	}
+	return &stateLock{file: lockFile}, nil
+}
+
+// staleLock reports whether the run holding lockFile is no longer running.
+// A lock without a PID is never stale, it may be being written.
+func staleLock(lockFile string) bool {
+	data, err := ioutil.ReadFile(lockFile)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	return !processRunning(pid)
+}
+
+// processRunning reports whether the process pid exists. Signal 0 only checks that it can be signalled.
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH)
+}
+
+func (l *stateLock) unlock() error {
+	return os.Remove(l.file)
 }
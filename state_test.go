@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m4dc0w/algo-export/exporter"
+)
+
+func TestStateMigrateVersion0(t *testing.T) {
+	// An unversioned state file with the AlgoFi state saved before application handlers had their own state.
+	legacy := []byte(`{"cointracking":{"ACCOUNT":{"LastRound":100,"AlgoFi":{"SupplyALGO":5,"BorrowUSDC":7}}}}`)
+	exportState, err := parseStateFile(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountState := exportState.ForAccount("cointracking", "ACCOUNT")
+	if accountState.LastRound != 100 || accountState.AlgoFi != nil {
+		t.Fatalf("got %+v", accountState)
+	}
+	var algoFiState exporter.LendingState
+	if err := accountState.Appl.Get(exporter.AlgoFiStateName, &algoFiState); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]exporter.LendingMarket{
+		"465814065-0":        {AppID: 465814065, AssetID: 0, Supply: 5},
+		"465814103-31566704": {AppID: 465814103, AssetID: 31566704, Borrow: 7},
+	}
+	if len(algoFiState.Markets) != len(want) {
+		t.Errorf("got %d markets, want %d", len(algoFiState.Markets), len(want))
+	}
+	for key, market := range want {
+		if got := algoFiState.Markets[key]; got == nil || *got != market {
+			t.Errorf("market %s: got %+v, want %+v", key, got, market)
+		}
+	}
+
+	if _, err := parseStateFile([]byte(`{"Version":99,"Formats":{}}`)); err == nil {
+		t.Error("expected an error for a newer state file version")
+	}
+}
+
+func TestStateSaveBackupsAndLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "state.json")
+
+	lock, err := lockState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockState(file); err == nil {
+		t.Error("expected the second lock to fail")
+	}
+	// A lock without a PID is not stale.
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.json.lock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockState(filepath.Join(dir, "other.json")); err == nil {
+		t.Error("expected a lock without a PID to be kept")
+	}
+
+	exportState := ExportState{}
+	for round := uint64(1); round <= 4; round++ {
+		exportState.ForAccount("cointracking", "ACCOUNT").LastRound = round
+		if err := exportState.SaveConfig(file, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The state file holds the last save, the backups the two before it.
+	for file, want := range map[string]uint64{file: 4, file + ".1": 3, file + ".2": 2} {
+		loaded, err := LoadConfig(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := loaded.ForAccount("cointracking", "ACCOUNT").LastRound; got != want {
+			t.Errorf("%s: got LastRound %d, want %d", filepath.Base(file), got, want)
+		}
+	}
+	if fileExist(file + ".3") {
+		t.Error("expected only 2 backups")
+	}
+
+	if err := lock.unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockState(file); err != nil {
+		t.Errorf("expected the lock to be free: %v", err)
+	}
+}